@@ -1,7 +1,25 @@
 
 $(document).ready(function () {
     showLoader();
-    $.get("/api/audit/"+currentPage(), function (auditEntries) {
+    // Paging is by cursor: "before" is the audit id of the last entry on the previous page.
+    // "previous" lists the cursors of the pages leading here (0 for the latest page), such that
+    // paging back does not depend on browser history.
+    var beforeMatch = /[?&]before=(\d+)/.exec(window.location.search);
+    var before = beforeMatch ? beforeMatch[1] : auditBefore();
+    var previousMatch = /[?&]previous=([\d,]+)/.exec(window.location.search);
+    var previous = previousMatch ? previousMatch[1].split(",") : [];
+    function auditPageHref(pageBefore, pagePrevious) {
+        // A page number in the path (/web/audit/:page) is superseded by the cursor
+        var href = window.location.pathname.replace(/^\/web\/audit\/\d+$/, "/web/audit");
+        if (pageBefore && pageBefore != "0") {
+            href += "?before="+pageBefore;
+            if (pagePrevious.length > 0) {
+                href += "&previous="+pagePrevious.join(",");
+            }
+        }
+        return href;
+    }
+    $.get("/api/audit?instance="+encodeURIComponent(auditInstance())+"&before="+before, function (auditEntries) {
             displayAudit(auditEntries);
     	}, "json");
     function displayAudit(auditEntries) {
@@ -11,20 +29,24 @@ $(document).ready(function () {
     		jQuery('<td/>', { text: audit.AuditTimestamp }).appendTo(row);
     		jQuery('<td/>', { text: audit.AuditType }).appendTo(row);
     		jQuery('<td/>', { text: audit.AuditInstanceKey.Hostname+":"+audit.AuditInstanceKey.Port }).appendTo(row);
+    		jQuery('<td/>', { text: audit.Owner }).appendTo(row);
     		jQuery('<td/>', { text: audit.Message }).appendTo(row);
     		row.appendTo('#audit tbody');    		
     	});
-        if (currentPage() <= 0) {
+        if (!before) {
         	$("#audit .pager .previous").addClass("disabled");
         }
         if (auditEntries.length == 0) {
         	$("#audit .pager .next").addClass("disabled");        	
         }
         $("#audit .pager .previous").not(".disabled").find("a").click(function() {
-            window.location.href = "/web/audit/"+(currentPage() - 1);
+            // A deep link without "previous" pages back to the latest entries
+            var pagePrevious = previous.slice(0);
+            var pageBefore = pagePrevious.length > 0 ? pagePrevious.pop() : "0";
+            window.location.href = auditPageHref(pageBefore, pagePrevious);
         });
         $("#audit .pager .next").not(".disabled").find("a").click(function() {
-            window.location.href = "/web/audit/"+(currentPage() + 1);
+            window.location.href = auditPageHref(auditEntries[auditEntries.length - 1].AuditId, previous.concat([before || "0"]));
         });
         $("#audit .pager .disabled a").click(function() {
             return false;
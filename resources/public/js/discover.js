@@ -24,5 +24,24 @@ $(document).ready(function () {
         }, "json"); 
         return false;
     });
+
+    $.get("/api/discovery-seeds", function (seeds) {
+        if (seeds.length == 0) {
+            $("#discovery_seeds").hide();
+        }
+        seeds.forEach(function (seed) {
+            var row = jQuery('<tr/>');
+            var instanceTitle = seed.Key.Hostname+":"+seed.Key.Port;
+            jQuery('<td/>').append(jQuery('<a/>', { text: instanceTitle, href: "/web/search?s="+instanceTitle })).appendTo(row);
+            jQuery('<td/>', { text: seed.SeedSource }).appendTo(row);
+            jQuery('<td/>', { text: seed.FirstSeen }).appendTo(row);
+            if (seed.IsRemoved) {
+                jQuery('<td/>').append(jQuery('<span/>', { text: "removed " + seed.RemovedTimestamp, "class": "label label-warning" })).appendTo(row);
+            } else {
+                jQuery('<td/>', { text: "active" }).appendTo(row);
+            }
+            row.appendTo('#discovery_seeds tbody');
+        });
+    }, "json");
 });
 
@@ -120,6 +120,8 @@ function openNodeModal(node) {
     addNodeModalDataAttribute("Logs slave updates", booleanString(node.LogSlaveUpdatesEnabled));
     addNodeModalDataAttribute("Cluster",
             '<a href="/web/cluster/'+node.ClusterName+'">'+node.ClusterName+'</a>');
+    addNodeModalDataAttribute("Audit",
+            '<a href="/web/audit/instance/'+node.Key.Hostname+'/'+node.Key.Port+'">view</a>');
     
     // $('#node_modal button[data-btn=begin-maintenance]').unbind("click");
     // $('#node_modal button[data-btn=end-maintenance]').unbind("click");
@@ -214,7 +216,7 @@ function openNodeModal(node) {
     if (node.inMaintenance) {
     	$('#node_modal [data-panel-type=maintenance]').html("In maintenance");
     	$('#node_modal [data-description=maintenance-status]').html(
-    			"Started " + node.maintenanceEntry.BeginTimestamp + " by "+node.maintenanceEntry.Owner + ".<br/>Reason: "+node.maintenanceEntry.Reason
+    			"Started " + node.maintenanceEntry.BeginTimestamp + " by "+node.maintenanceEntry.Owner + ".<br/>Reason: "+node.maintenanceEntry.Reason + "<br/>Expires: " + node.maintenanceEntry.EndTimestamp
     	);    	
     	$('#node_modal [data-panel-type=begin-maintenance]').hide();
     	$('#node_modal [data-panel-type=end-maintenance]').show();
@@ -271,7 +273,7 @@ function normalizeInstanceProblem(instance) {
     	instance.problem = "in_maintenance";
     	instance.problemOrder = 1;
     } else if (!instance.IsLastCheckValid) {
-    	instance.problem = "last_check_invalid";
+    	instance.problem = (instance.IsUnreachable ? "unreachable" : "last_check_invalid");
     	instance.problemOrder = 2;
     } else if (!instance.IsRecentlyChecked) {
     	instance.problem = "not_recently_checked";
@@ -373,11 +375,26 @@ function renderInstanceElement(popoverElement, instance, renderType) {
 	if (indicateLastSeenInStatus) {
 		statusMessage = 'seen ' + instance.SecondsSinceLastSeen.Int64 + ' seconds ago';
 	}
+	if (instance.IsUnreachable) {
+		statusMessage = 'unreachable; ' + statusMessage;
+	}
     var contentHtml = ''
         	+ '<div class="pull-right">' + statusMessage + ' </div>'
    		+ '<p>' 
 			+ instance.Version + " " + instance.Binlog_format 
         + '</p>';
+    if (instance.DataCenter) {
+    	contentHtml += '<p>DC: ' + instance.DataCenter + '</p>';
+    }
+    if (instance.UsesSSL || instance.MasterSSLAllowed) {
+    	contentHtml += '<p>SSL: ' + (instance.UsesSSL ? 'connection' : '') + (instance.UsesSSL && instance.MasterSSLAllowed ? ', ' : '') + (instance.MasterSSLAllowed ? 'replication' : '') + '</p>';
+    }
+    if (instance.LastIOErrno) {
+    	contentHtml += '<p class="text-danger">IO error ' + instance.LastIOErrno + ' ' + instance.LastIOErrorTimestamp + ': ' + $('<div/>').text(instance.LastIOError).html() + '</p>';
+    }
+    if (instance.LastSQLErrno) {
+    	contentHtml += '<p class="text-danger">SQL error ' + instance.LastSQLErrno + ' ' + instance.LastSQLErrorTimestamp + ': ' + $('<div/>').text(instance.LastSQLError).html() + '</p>';
+    }
     if (instance.isCoMaster) {
     	contentHtml += '<p><strong>Co master</strong></p>';
     }
@@ -410,9 +427,16 @@ function onClusters(func) {
 } 
 
 $(document).ready(function() {
-	$.get("/api/clusters", function(clusters) {
-		clusters.forEach(function(cluster) {                      
-	        $("#dropdown-clusters").append('<li><a href="/web/cluster/'+cluster+'">'+cluster+'</a></li>');
+	$.get("/api/clusters-info", function(clustersInfo) {
+		var clusters = clustersInfo.map(function(clusterInfo) {
+			return clusterInfo.ClusterName;
+		});
+		clustersInfo.forEach(function(clusterInfo) {
+			var title = clusterInfo.ClusterName;
+			if (clusterInfo.ClusterAlias) {
+				title = clusterInfo.ClusterAlias + ' <small>(' + clusterInfo.ClusterName + ')</small>';
+			}
+	        $("#dropdown-clusters").append('<li><a href="/web/cluster/'+clusterInfo.ClusterName+'">'+title+'</a></li>');
 	    });                 
 		onClustersListeners.forEach(function(func) {
 			func(clusters);
@@ -20,20 +20,45 @@ import (
 	"fmt"
 	"strings"
 	"os/user"
+	"time"
 	"github.com/outbrain/orchestrator/inst"	
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/db"
 	"github.com/outbrain/orchestrator/logic"
 	"github.com/outbrain/log"
 )
 
 
+// CliFlags are the command line options of CLI commands. Each command uses those relevant to it.
+type CliFlags struct {
+	Instance		string
+	Sibling			string
+	Owner			string
+	Reason			string
+	Tag				string
+	PromotionRule	string
+	Page			int
+	Duration		string
+	Since			string
+	Until			string
+	File			string
+	AuditType		string
+	Cluster			string
+}
+
 // Cli initiates a command line interface, executing requested command.
-func Cli(command string, instance string, sibling string, owner string, reason string) {
+func Cli(command string, flags *CliFlags) {
+	instance, sibling, owner, reason := flags.Instance, flags.Sibling, flags.Owner, flags.Reason
+	tag, promotionRule, page, duration := flags.Tag, flags.PromotionRule, flags.Page, flags.Duration
+	since, until, file, auditType, cluster := flags.Since, flags.Until, flags.File, flags.AuditType, flags.Cluster
 	
 	instanceKey, err := inst.ParseInstanceKey(instance)
 	if err != nil {instanceKey = nil}
 	siblingKey, err := inst.ParseInstanceKey(sibling)
 	if err != nil {siblingKey = nil}
 
+	// owner as explicitly given, which filters audit entries
+	auditOwner := owner
 	if len(owner) == 0 {
 		// get os username as owner
 		usr, err := user.Current()
@@ -44,18 +69,27 @@ func Cli(command string, instance string, sibling string, owner string, reason s
 	}
 		
 	if len(command) == 0 {
-		log.Fatal("expected command (-c) (discover|forget|continuous|move-up|move-below|begin-maintenance|end-maintenance|clusters|topology)")
+		log.Fatal("expected command (-c) (discover|forget|continuous|move-up|move-up-slaves|move-below|begin-maintenance|end-maintenance|clusters|cluster|search|topology|tag|untag|tags|tagged|register-candidate|candidate-slave|events|discovery-timings|begin-downtime|end-downtime|downtimed|migrate-status|audit-export|audit)")
 	}
 	switch command {
 		case "move-up": {
 			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
-			_, err := inst.MoveUp(instanceKey)
+			_, err := inst.MoveUp(instanceKey, owner)
 			if err != nil {log.Errore( err)}
 		}
+		case "move-up-slaves": {
+			// Only slaves satisfying --tag selectors, if given, are moved up
+			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
+			slaves, err := inst.MoveUpSlaves(instanceKey, tag, owner)
+			for _, slave := range slaves {
+				fmt.Println(slave.Key.DisplayString())
+			}
+			if err != nil {log.Errore(err)}
+		}
 		case "move-below": {
 			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
 			if siblingKey == nil {log.Fatal("Cannot deduce sibling:", sibling)}
-			_, err := inst.MoveBelow(instanceKey, siblingKey)
+			_, err := inst.MoveBelow(instanceKey, siblingKey, owner)
 			if err != nil {log.Errore(err)}
 		}
 		case "discover": {
@@ -70,7 +104,12 @@ func Cli(command string, instance string, sibling string, owner string, reason s
 			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
 			if owner == "" {log.Fatal("--owner option required")}
 			if reason == "" {log.Fatal("--reason option required")}
-			maintenanceKey, err := inst.BeginMaintenance(instanceKey, owner, reason)
+			maintenanceDuration := time.Duration(config.Config.ManualMaintenanceExpireMinutes) * time.Minute
+			if duration != "" {
+				if maintenanceDuration, err = time.ParseDuration(duration); err != nil {log.Fatale(err)}
+			}
+			// The CLI process is short lived; the maintenance outlives it until ended or expired
+			maintenanceKey, err := inst.BeginBoundedMaintenance(instanceKey, owner, reason, maintenanceDuration, false)
 			if err == nil {log.Infof("Maintenance key: %+v", maintenanceKey)}
 			if err != nil {log.Errore(err)}
 		}
@@ -79,6 +118,29 @@ func Cli(command string, instance string, sibling string, owner string, reason s
 			err := inst.EndMaintenanceByInstanceKey(instanceKey)
 			if err != nil {log.Errore(err)}
 		}
+		case "begin-downtime": {
+			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
+			if reason == "" {log.Fatal("--reason option required")}
+			downtimeDuration, err := time.ParseDuration(duration)
+			if err != nil {log.Fatal("--duration option required (e.g. 30m, 4h):", err)}
+			err = inst.BeginDowntime(instanceKey, owner, reason, downtimeDuration)
+			if err != nil {log.Errore(err)}
+		}
+		case "end-downtime": {
+			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
+			err := inst.EndDowntime(instanceKey)
+			if err != nil {log.Errore(err)}
+		}
+		case "downtimed": {
+			downtimes, err := inst.ReadActiveDowntime()
+			if err != nil {
+				log.Errore(err)
+			} else {
+				for _, downtime := range downtimes {
+					fmt.Println(strings.Join([]string{downtime.Key.DisplayString(), downtime.EndTimestamp, downtime.Owner, downtime.Reason}, "\t"))
+				}
+			}
+		}
 		case "clusters": {
 			clusters, err := inst.ReadClusters()
 			if err != nil {
@@ -87,8 +149,33 @@ func Cli(command string, instance string, sibling string, owner string, reason s
 				fmt.Println(strings.Join(clusters, "\n"))
 			}
 		}
+		case "cluster": {
+			// instance may be a cluster name (which is the master's host:port) or a cluster alias
+			if instance == "" {log.Fatal("Expected cluster name or alias (-i)")}
+			instances, err := inst.ReadClusterInstances(instance, tag)
+			if err != nil {
+				log.Errore(err)
+			} else {
+				for _, clusterInstance := range instances {
+					fmt.Println(clusterInstance.Key.DisplayString())
+				}
+			}
+		}
+		case "search": {
+			// instance is the search string
+			if instance == "" {log.Fatal("Expected search string (-i)")}
+			instances, err := inst.SearchInstances(instance, tag)
+			if err != nil {
+				log.Errore(err)
+			} else {
+				for _, foundInstance := range instances {
+					fmt.Println(foundInstance.Key.DisplayString())
+				}
+			}
+		}
 		case "topology": {
-			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
+			// instance may be a cluster name (which is the master's host:port) or a cluster alias
+			if instance == "" {log.Fatal("Expected cluster name or alias (-i)")}
 			output, err := inst.AsciiTopology(instance)
 			if err != nil {
 				log.Errore(err)
@@ -96,6 +183,130 @@ func Cli(command string, instance string, sibling string, owner string, reason s
 				fmt.Println(output)
 			}
 		}
+		case "tag": {
+			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
+			parsedTag, err := inst.ParseTag(tag)
+			if err != nil {log.Fatale(err)}
+			err = inst.PutInstanceTag(instanceKey, parsedTag)
+			if err != nil {log.Errore(err)}
+		}
+		case "untag": {
+			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
+			parsedTag, err := inst.ParseTag(tag)
+			if err != nil {log.Fatale(err)}
+			err = inst.UntagInstance(instanceKey, parsedTag.TagName)
+			if err != nil {log.Errore(err)}
+		}
+		case "tags": {
+			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
+			tags, err := inst.ReadInstanceTags(instanceKey)
+			if err != nil {
+				log.Errore(err)
+			} else {
+				for _, instanceTag := range tags {
+					fmt.Println(instanceTag.String())
+				}
+			}
+		}
+		case "tagged": {
+			instanceKeys, err := inst.ReadInstanceKeysByTags(tag)
+			if err != nil {
+				log.Errore(err)
+			} else {
+				for _, taggedKey := range instanceKeys.GetInstanceKeys() {
+					fmt.Println(taggedKey.DisplayString())
+				}
+			}
+		}
+		case "register-candidate": {
+			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
+			rule, err := inst.ParseCandidatePromotionRule(promotionRule)
+			if err != nil {log.Fatale(err)}
+			err = inst.RegisterCandidateInstance(instanceKey, rule)
+			if err != nil {log.Errore(err)}
+		}
+		case "candidate-slave": {
+			if instanceKey == nil {log.Fatal("Cannot deduce instance:", instance)}
+			candidate, err := inst.GetCandidateSlave(instanceKey)
+			if err != nil {
+				log.Errore(err)
+			} else {
+				fmt.Println(candidate.Key.DisplayString())
+			}
+		}
+		case "events": {
+			var events []inst.InstanceEvent
+			if instanceKey != nil {
+				events, err = inst.ReadInstanceEvents(instanceKey, page)
+			} else {
+				events, err = inst.ReadRecentInstanceEvents(page)
+			}
+			if err != nil {
+				log.Errore(err)
+			} else {
+				for _, event := range events {
+					fmt.Println(strings.Join([]string{event.EventTimestamp, event.Key.DisplayString(), string(event.EventType), event.OldValue, event.NewValue}, "\t"))
+				}
+			}
+		}
+		case "discovery-timings": {
+			// Timings are persisted by the discovering orchestrator service; this reports on those, without
+			// reading any instance
+			timings, err := inst.ReadStoredDiscoveryTimings()
+			if err != nil {log.Fatale(err)}
+			if instanceKey != nil {
+				timings = inst.DiscoveryTimings{*instanceKey: timings[*instanceKey]}
+			}
+			for _, summary := range timings.SlowestInstances(0) {
+				phases := []string{}
+				for _, phase := range inst.DiscoveryPhases {
+					phases = append(phases, fmt.Sprintf("%s=%.1f", phase, summary.AveragePhaseMillis[phase]))
+				}
+				fmt.Println(fmt.Sprintf("%s\t%.1fms\t%s", summary.Key.DisplayString(), summary.AverageMillis, strings.Join(phases, " ")))
+			}
+			for _, p := range timings.Percentiles() {
+				fmt.Println(fmt.Sprintf("p%.0f\t%s\t%.1fms", p.Percentile, p.Phase, p.Millis))
+			}
+		}
+		case "migrate-status": {
+			schemaVersion, migrations, err := db.ReadSchemaMigrationStatus()
+			if err != nil {log.Fatale(err)}
+			fmt.Println(fmt.Sprintf("backend schema version: %d, binary schema version: %d", schemaVersion, db.SchemaVersion()))
+			for _, migration := range migrations {
+				status := "pending"
+				if migration.IsApplied {
+					status = "applied"
+				}
+				fmt.Println(strings.Join([]string{fmt.Sprintf("%d", migration.Version), status, migration.AppliedTimestamp, migration.Description}, "\t"))
+			}
+			if schemaVersion > db.SchemaVersion() {
+				fmt.Println("backend schema is newer than this binary")
+			}
+		}
+		case "audit": {
+			filter := &inst.AuditFilter{ClusterName: cluster, AuditType: auditType, Owner: auditOwner, Since: since, Until: until}
+			if instanceKey != nil {
+				filter.InstanceKey = *instanceKey
+			}
+			for {
+				audits, err := inst.ReadAudit(filter)
+				if err != nil {log.Fatale(err)}
+				if len(audits) == 0 {
+					break
+				}
+				for _, audit := range audits {
+					fmt.Println(strings.Join([]string{fmt.Sprintf("%d", audit.AuditId), audit.AuditTimestamp, audit.AuditType, 
+						audit.AuditInstanceKey.DisplayString(), audit.Owner, audit.Message}, "\t"))
+				}
+				filter.BeforeAuditId = audits[len(audits) - 1].AuditId
+			}
+		}
+		case "audit-export": {
+			if file == "" {log.Fatal("expected output file (-file)")}
+			count, err := inst.ExportAudit(file, since, until)
+			if err != nil {log.Fatale(err)}
+			fmt.Println(fmt.Sprintf("exported %d audit entries into %s", count, file))
+		}
 		case "continuous": {
 			orchestrator.ContinuousDiscovery()
 		}
@@ -19,21 +19,53 @@ package config
 import (
     "encoding/json"
     "os"
+    "regexp"
+    "strings"
     
 	"github.com/outbrain/log"
 )
 
+// ClusterConfiguration overrides global lag settings for clusters whose name or alias matches ClusterPattern.
+// Empty/zero values fall back to the global settings.
+type ClusterConfiguration struct {
+	ClusterPattern				string	// Regexp applied on cluster name and cluster alias
+	SlaveLagQuery				string
+	ReasonableReplicationLagSeconds	int
+	ReasonableMaintenanceReplicationLagSeconds int
+
+	clusterRegexp				*regexp.Regexp	// Compiled ClusterPattern
+}
+
 // Configuration makes for orchestrator configuration input, which can be provided by user via JSON formatted file.
 // Some of the parameteres have reasonable default values, and some (like database credentials) are 
 // strictly expected from user.
 type Configuration struct {
 	MySQLTopologyUser		string
 	MySQLTopologyPassword	string
+	MySQLTopologyCredentialsProvider	string	// Source of topology credentials: "static" (MySQLTopologyUser/MySQLTopologyPassword), "cnf-file", "env" or "mapped-file"
+	MySQLTopologyCredentialsConfigFile	string	// MySQL style .cnf file with user & password in [client] section (for "cnf-file" provider)
+	MySQLTopologyCredentialsMappingFile	string	// JSON file mapping cluster/hostname patterns onto credentials (for "mapped-file" provider)
+	MySQLTopologyConnectTimeoutSeconds	uint	// Connect timeout for topology instances. 0 means no timeout
+	MySQLTopologyReadTimeoutSeconds		uint	// Read/write timeout for topology instances. 0 means no timeout
+	MySQLTopologyUseSSL			bool		// Connect to topology instances over TLS
+	MySQLTopologySSLCAFile		string		// CA certificate (PEM) verifying topology instances. Empty means system CAs
+	MySQLTopologySSLCertFile	string		// Client certificate (PEM) presented to topology instances, optional
+	MySQLTopologySSLPrivateKeyFile	string	// Client private key (PEM) matching MySQLTopologySSLCertFile
+	MySQLTopologySSLSkipVerify	bool		// Do not verify topology instances' certificates (encryption only)
+	BackendDB				string		// The orchestrator backend: "mysql" (default, see MySQLOrchestrator* settings) or "sqlite"
+	SQLite3DataFile			string		// Path of the SQLite data file, when BackendDB is "sqlite"
 	MySQLOrchestratorHost	string
 	MySQLOrchestratorPort	uint
 	MySQLOrchestratorDatabase	string
 	MySQLOrchestratorUser		string
 	MySQLOrchestratorPassword	string
+	MySQLOrchestratorConnectTimeoutSeconds	uint	// Connect timeout for the orchestrator backend. 0 means no timeout
+	MySQLOrchestratorReadTimeoutSeconds		uint	// Read/write timeout for the orchestrator backend. 0 means no timeout
+	MySQLOrchestratorUseSSL			bool		// Connect to the orchestrator backend over TLS
+	MySQLOrchestratorSSLCAFile		string		// CA certificate (PEM) verifying the orchestrator backend. Empty means system CAs
+	MySQLOrchestratorSSLCertFile	string		// Client certificate (PEM) presented to the orchestrator backend, optional
+	MySQLOrchestratorSSLPrivateKeyFile	string	// Client private key (PEM) matching MySQLOrchestratorSSLCertFile
+	MySQLOrchestratorSSLSkipVerify	bool		// Do not verify the orchestrator backend's certificate (encryption only)
 	SlaveLagQuery				string		// custom query to check on slave lg (e.g. heartbeat table)
 	SlaveStartPostWaitMilliseconds	int		// Time to wait after START SLAVE before re-readong instance (give slave chance to connect to master)
 	DiscoverByShowSlaveHosts	bool		// Attempt SHOW SLAVE HOSTS before PROCESSLIST
@@ -43,14 +75,58 @@ type Configuration struct {
 	ReasonableReplicationLagSeconds	int		// Abvoe this value is considered a problem
 	ReasonableMaintenanceReplicationLagSeconds int // Above this value move-up and move-below are blocked
 	AuditPageSize		int
+	AuditPurgeDays		uint		// Audit entries older than this many days are purged. 0 keeps audit forever
+	AuditArchiveDirectory	string	// When set, audit entries are exported to gzip'd JSON-lines files in this directory before being purged
+	InstanceEventsPageSize	int
 	HTTPAuthUser		string				// Username for HTTP Basic authentication (blank disables authentication)
 	HTTPAuthPassword	string				// Password for HTTP Basic authentication
+	HostnameAliases		map[string]string	// Static alias => canonical hostname mapping (e.g. VIP or DNS alias used by slaves to connect to a master)
+	HostnameUnresolves	map[string]string	// Static canonical hostname => alias mapping: slaves are pointed at a master by its alias (e.g. VIP) upon change master
+	DiscoverySeeds		[]string			// List of host:port instances to discover upon continuous discovery startup
+	DiscoverySeedsFile	string				// File listing host:port instances (one per line) to discover; watched for changes during continuous discovery
+	DiscoveryIgnoreHostnameFilters			[]string	// Regexp filters; instances with matching hostnames are neither discovered nor stored
+	DiscoveryIgnoreMasterHostnameFilters	[]string	// Regexp filters; slaves of masters with matching hostnames are neither discovered nor stored
+	DetectClusterAliasQuery	string			// Optional query (executed on topology master) returning a single row, single column: the cluster's human readable alias
+	DetectDataCenterQuery	string			// Optional query (executed on topology instance) returning the data center of an instance. Takes precedence over DataCenterPattern
+	DataCenterPattern		string			// Regexp with a single capture group, applied on hostname, extracting the data center name
+	DetectPhysicalEnvironmentQuery	string	// Optional query (executed on topology instance) returning the physical environment (e.g. prod, qa) of an instance. Takes precedence over PhysicalEnvironmentPattern
+	PhysicalEnvironmentPattern		string	// Regexp with a single capture group, applied on hostname, extracting the physical environment
+	CandidateInstanceExpireMinutes	uint	// Minutes after which a registered candidate promotion rule expires (rules are expected to be periodically re-registered)
+	TopologySnapshotIntervalMinutes	uint	// Interval between topology snapshots, taken during continuous discovery. 0 disables snapshots
+	TopologySnapshotRetentionDays	uint	// Number of days for which topology snapshots are kept
+	DiscoveryTimingSamplesPerInstance	uint	// Number of recent discovery timings kept (in memory) per instance
+	LagHistoryRetentionDays		uint		// Number of days for which slave lag samples are kept
+	LagHistoryDownsampleHours	uint		// Lag samples older than this many hours are downsampled. 0 disables downsampling
+	LagHistoryDownsampleMinutes	uint		// Downsampled lag history keeps one sample per instance per this many minutes
+	ClusterConfigurations	[]ClusterConfiguration	// Per cluster overrides of lag settings. The first configuration to match a cluster applies
+	HealthPollSeconds			uint	// Interval at which an orchestrator process registers itself as alive
+	ActiveNodeExpireSeconds		uint	// An orchestrator process not registered as alive for this many seconds is considered gone
+	MaintenanceExpireMinutes	uint	// Default duration of a maintenance entry, after which it is forcibly ended
+	ManualMaintenanceExpireMinutes	uint	// Default duration of a maintenance entry begun via CLI or API with no explicit duration
+
+	discoveryIgnoreHostnameRegexps			[]*regexp.Regexp	// Compiled DiscoveryIgnoreHostnameFilters
+	discoveryIgnoreMasterHostnameRegexps	[]*regexp.Regexp	// Compiled DiscoveryIgnoreMasterHostnameFilters
+	dataCenterRegexp			*regexp.Regexp	// Compiled DataCenterPattern, nil if empty
+	physicalEnvironmentRegexp	*regexp.Regexp	// Compiled PhysicalEnvironmentPattern, nil if empty
 }	
 
 var Config *Configuration = NewConfiguration()
 
 func NewConfiguration() *Configuration {
 	return &Configuration {
+		MySQLTopologyCredentialsProvider:	"static",
+		MySQLTopologyCredentialsConfigFile:	"",
+		MySQLTopologyCredentialsMappingFile:	"",
+		MySQLTopologyConnectTimeoutSeconds:	2,
+		MySQLTopologyReadTimeoutSeconds:	30,
+		BackendDB:					"mysql",
+		SQLite3DataFile:			"",
+		MySQLOrchestratorConnectTimeoutSeconds:	5,
+		MySQLOrchestratorReadTimeoutSeconds:	30,
+		MySQLTopologyUseSSL:		false,
+		MySQLTopologySSLSkipVerify:	false,
+		MySQLOrchestratorUseSSL:	false,
+		MySQLOrchestratorSSLSkipVerify:	false,
 		InstancePollSeconds:		60,
 		UnseenInstanceForgetHours:	240,
 		SlaveStartPostWaitMilliseconds: 1000,
@@ -59,9 +135,160 @@ func NewConfiguration() *Configuration {
 		ReasonableReplicationLagSeconds: 10,
 		ReasonableMaintenanceReplicationLagSeconds: 20,
 		AuditPageSize:				20,
+		AuditPurgeDays:				0,
+		AuditArchiveDirectory:		"",
+		InstanceEventsPageSize:		20,
 		HTTPAuthUser: 				"",
 		HTTPAuthPassword: 			"",
+		HostnameAliases:			make(map[string]string),
+		HostnameUnresolves:			make(map[string]string),
+		DiscoverySeeds:				[]string{},
+		DiscoverySeedsFile:			"",
+		DiscoveryIgnoreHostnameFilters:	[]string{},
+		DiscoveryIgnoreMasterHostnameFilters:	[]string{},
+		DetectClusterAliasQuery:	"",
+		DetectDataCenterQuery:		"",
+		DataCenterPattern:			"",
+		DetectPhysicalEnvironmentQuery:	"",
+		PhysicalEnvironmentPattern:	"",
+		CandidateInstanceExpireMinutes:	60,
+		TopologySnapshotIntervalMinutes:	10,
+		TopologySnapshotRetentionDays:	7,
+		DiscoveryTimingSamplesPerInstance:	10,
+		LagHistoryRetentionDays:	7,
+		LagHistoryDownsampleHours:	24,
+		LagHistoryDownsampleMinutes:	10,
+		ClusterConfigurations:		[]ClusterConfiguration{},
+		HealthPollSeconds:			5,
+		ActiveNodeExpireSeconds:	60,
+		MaintenanceExpireMinutes:	10,
+		ManualMaintenanceExpireMinutes:	1440,
+	}
+}
+
+
+// GetClusterConfiguration returns the effective lag settings for a cluster given by name and (possibly empty) alias:
+// those of the first ClusterConfigurations entry matching either, backed by global settings.
+func (this *Configuration) GetClusterConfiguration(clusterName string, clusterAlias string) *ClusterConfiguration {
+	clusterConfiguration := &ClusterConfiguration{
+		SlaveLagQuery:					this.SlaveLagQuery,
+		ReasonableReplicationLagSeconds:	this.ReasonableReplicationLagSeconds,
+		ReasonableMaintenanceReplicationLagSeconds:	this.ReasonableMaintenanceReplicationLagSeconds,
+	}
+	for _, override := range this.ClusterConfigurations {
+		if override.clusterRegexp == nil {
+			// Not compiled (see CompileClusterConfigurations)
+			continue
+		}
+		matched := override.clusterRegexp.MatchString(clusterName)
+		if !matched && clusterAlias != "" {
+			matched = override.clusterRegexp.MatchString(clusterAlias)
+		}
+		if !matched {
+			continue
+		}
+		clusterConfiguration.ClusterPattern = override.ClusterPattern
+		if override.SlaveLagQuery != "" {
+			clusterConfiguration.SlaveLagQuery = override.SlaveLagQuery
+		}
+		if override.ReasonableReplicationLagSeconds > 0 {
+			clusterConfiguration.ReasonableReplicationLagSeconds = override.ReasonableReplicationLagSeconds
+		}
+		if override.ReasonableMaintenanceReplicationLagSeconds > 0 {
+			clusterConfiguration.ReasonableMaintenanceReplicationLagSeconds = override.ReasonableMaintenanceReplicationLagSeconds
+		}
+		break
+	}
+	return clusterConfiguration
+}
+
+// MinReasonableReplicationLagSeconds returns the lowest reasonable lag of all clusters, global setting included
+func (this *Configuration) MinReasonableReplicationLagSeconds() int {
+	minLag := this.ReasonableReplicationLagSeconds
+	for _, override := range this.ClusterConfigurations {
+		if override.ReasonableReplicationLagSeconds > 0 && override.ReasonableReplicationLagSeconds < minLag {
+			minLag = override.ReasonableReplicationLagSeconds
+		}
+	}
+	return minLag
+}
+
+// IsSQLite returns true when the orchestrator backend is an embedded SQLite database
+func (this *Configuration) IsSQLite() bool {
+	return strings.ToLower(this.BackendDB) == "sqlite" || strings.ToLower(this.BackendDB) == "sqlite3"
+}
+
+
+// CompileClusterConfigurations compiles the ClusterPattern of each of ClusterConfigurations. This is done upon
+// reading the configuration, and should be repeated should ClusterConfigurations change.
+func (this *Configuration) CompileClusterConfigurations() (err error) {
+	for i := range this.ClusterConfigurations {
+		if this.ClusterConfigurations[i].clusterRegexp, err = regexp.Compile(this.ClusterConfigurations[i].ClusterPattern); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// compileOptionalRegexp compiles given pattern, or returns nil if the pattern is empty
+func compileOptionalRegexp(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// CompileInstanceAttributePatterns compiles DataCenterPattern and PhysicalEnvironmentPattern. This is done upon
+// reading the configuration, and should be repeated should the patterns change.
+func (this *Configuration) CompileInstanceAttributePatterns() (err error) {
+	if this.dataCenterRegexp, err = compileOptionalRegexp(this.DataCenterPattern); err != nil {
+		return err
+	}
+	this.physicalEnvironmentRegexp, err = compileOptionalRegexp(this.PhysicalEnvironmentPattern)
+	return err
+}
+
+// DataCenterRegexp returns the compiled DataCenterPattern, or nil if none is configured
+func (this *Configuration) DataCenterRegexp() *regexp.Regexp {
+	return this.dataCenterRegexp
+}
+
+// PhysicalEnvironmentRegexp returns the compiled PhysicalEnvironmentPattern, or nil if none is configured
+func (this *Configuration) PhysicalEnvironmentRegexp() *regexp.Regexp {
+	return this.physicalEnvironmentRegexp
+}
+
+// compileRegexps compiles given regexp filters, failing on the first invalid one
+func compileRegexps(filters []string) ([]*regexp.Regexp, error) {
+	regexps := []*regexp.Regexp{}
+	for _, filter := range filters {
+		compiled, err := regexp.Compile(filter)
+		if err != nil {
+			return regexps, err
+		}
+		regexps = append(regexps, compiled)
+	}
+	return regexps, nil
+}
+
+// CompileDiscoveryFilters compiles DiscoveryIgnoreHostnameFilters and DiscoveryIgnoreMasterHostnameFilters.
+// This is done upon reading the configuration, and should be repeated should the filters change.
+func (this *Configuration) CompileDiscoveryFilters() (err error) {
+	if this.discoveryIgnoreHostnameRegexps, err = compileRegexps(this.DiscoveryIgnoreHostnameFilters); err != nil {
+		return err
+	}
+	this.discoveryIgnoreMasterHostnameRegexps, err = compileRegexps(this.DiscoveryIgnoreMasterHostnameFilters)
+	return err
+}
+
+// DiscoveryIgnoreHostnameRegexps returns the compiled DiscoveryIgnoreHostnameFilters
+func (this *Configuration) DiscoveryIgnoreHostnameRegexps() []*regexp.Regexp {
+	return this.discoveryIgnoreHostnameRegexps
+}
+
+// DiscoveryIgnoreMasterHostnameRegexps returns the compiled DiscoveryIgnoreMasterHostnameFilters
+func (this *Configuration) DiscoveryIgnoreMasterHostnameRegexps() []*regexp.Regexp {
+	return this.discoveryIgnoreMasterHostnameRegexps
 }
 
 
@@ -77,6 +304,15 @@ func read(file_name string) (*Configuration, error) {
 		} else {
 	  		log.Fatal("Cannot read config file:", file_name, err)
 		}
+		if err := Config.CompileDiscoveryFilters(); err != nil {
+			log.Fatal("Invalid discovery filter in config file:", file_name, err)
+		}
+		if err := Config.CompileClusterConfigurations(); err != nil {
+			log.Fatal("Invalid ClusterPattern in config file:", file_name, err)
+		}
+		if err := Config.CompileInstanceAttributePatterns(); err != nil {
+			log.Fatal("Invalid DataCenterPattern or PhysicalEnvironmentPattern in config file:", file_name, err)
+		}
 	}
 	return Config, err
 }
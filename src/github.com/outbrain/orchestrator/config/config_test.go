@@ -0,0 +1,80 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+
+func (s *TestSuite) TestGetClusterConfiguration(c *C) {
+	conf := NewConfiguration()
+	conf.SlaveLagQuery = "select global_lag"
+	conf.ClusterConfigurations = []ClusterConfiguration{
+		{ClusterPattern: "^payments", SlaveLagQuery: "select payments_lag", ReasonableReplicationLagSeconds: 2},
+		{ClusterPattern: "db-[0-9]+:3306", ReasonableMaintenanceReplicationLagSeconds: 60},
+	}
+	c.Assert(conf.CompileClusterConfigurations(), IsNil)
+
+	clusterConfiguration := conf.GetClusterConfiguration("db-001:3306", "payments")
+	c.Assert(clusterConfiguration.SlaveLagQuery, Equals, "select payments_lag")
+	c.Assert(clusterConfiguration.ReasonableReplicationLagSeconds, Equals, 2)
+	c.Assert(clusterConfiguration.ReasonableMaintenanceReplicationLagSeconds, Equals, conf.ReasonableMaintenanceReplicationLagSeconds)
+
+	clusterConfiguration = conf.GetClusterConfiguration("db-002:3306", "")
+	c.Assert(clusterConfiguration.SlaveLagQuery, Equals, "select global_lag")
+	c.Assert(clusterConfiguration.ReasonableReplicationLagSeconds, Equals, conf.ReasonableReplicationLagSeconds)
+	c.Assert(clusterConfiguration.ReasonableMaintenanceReplicationLagSeconds, Equals, 60)
+
+	c.Assert(conf.MinReasonableReplicationLagSeconds(), Equals, 2)
+
+	conf.ClusterConfigurations = append(conf.ClusterConfigurations, ClusterConfiguration{ClusterPattern: "db-("})
+	c.Assert(conf.CompileClusterConfigurations(), NotNil)
+}
+
+
+func (s *TestSuite) TestCompileDiscoveryFilters(c *C) {
+	conf := NewConfiguration()
+	conf.DiscoveryIgnoreHostnameFilters = []string{"^sandbox[0-9]+[.]"}
+	c.Assert(conf.CompileDiscoveryFilters(), IsNil)
+	c.Assert(len(conf.DiscoveryIgnoreHostnameRegexps()), Equals, 1)
+	c.Assert(conf.DiscoveryIgnoreHostnameRegexps()[0].MatchString("sandbox7.db"), Equals, true)
+
+	conf.DiscoveryIgnoreMasterHostnameFilters = []string{"[.]test("}
+	c.Assert(conf.CompileDiscoveryFilters(), NotNil)
+}
+
+
+func (s *TestSuite) TestCompileInstanceAttributePatterns(c *C) {
+	conf := NewConfiguration()
+	c.Assert(conf.CompileInstanceAttributePatterns(), IsNil)
+	c.Assert(conf.DataCenterRegexp(), IsNil)
+
+	conf.DataCenterPattern = "[.]([^.]+)[.]example[.]com$"
+	c.Assert(conf.CompileInstanceAttributePatterns(), IsNil)
+	c.Assert(conf.DataCenterRegexp().FindStringSubmatch("db1.ny.example.com")[1], Equals, "ny")
+
+	conf.PhysicalEnvironmentPattern = "^(prod|qa"
+	c.Assert(conf.CompileInstanceAttributePatterns(), NotNil)
+}
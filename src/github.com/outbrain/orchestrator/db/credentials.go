@@ -0,0 +1,307 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+const (
+	StaticCredentialsProvider = "static"
+	CnfFileCredentialsProvider = "cnf-file"
+	EnvCredentialsProvider = "env"
+	MappedFileCredentialsProvider = "mapped-file"
+
+	TopologyUserEnvVariable = "ORCHESTRATOR_TOPOLOGY_USER"
+	TopologyPasswordEnvVariable = "ORCHESTRATOR_TOPOLOGY_PASSWORD"
+)
+
+// CredentialsProvider supplies the user & password by which to connect to a given topology instance
+type CredentialsProvider interface {
+	GetCredentials(host string, port int) (user string, password string, err error)
+}
+
+// staticCredentials provides the same MySQLTopologyUser/MySQLTopologyPassword for all instances
+type staticCredentials struct {}
+
+func (this *staticCredentials) GetCredentials(host string, port int) (string, string, error) {
+	return config.Config.MySQLTopologyUser, config.Config.MySQLTopologyPassword, nil
+}
+
+// envCredentials reads credentials from the ORCHESTRATOR_TOPOLOGY_USER & ORCHESTRATOR_TOPOLOGY_PASSWORD environment variables
+type envCredentials struct {}
+
+func (this *envCredentials) GetCredentials(host string, port int) (string, string, error) {
+	user := os.Getenv(TopologyUserEnvVariable)
+	if user == "" {
+		return "", "", errors.New(fmt.Sprintf("%s is not set", TopologyUserEnvVariable))
+	}
+	return user, os.Getenv(TopologyPasswordEnvVariable), nil
+}
+
+// cnfFileCredentials reads credentials from the [client] section of a MySQL style .cnf file.
+// The file is read once.
+type cnfFileCredentials struct {
+	fileName	string
+	once		sync.Once
+	user		string
+	password	string
+	err			error
+}
+
+func (this *cnfFileCredentials) GetCredentials(host string, port int) (string, string, error) {
+	this.once.Do(func() {
+		this.user, this.password, this.err = readCnfFileCredentials(this.fileName)
+	})
+	return this.user, this.password, this.err
+}
+
+// readCnfFileCredentials parses user & password out of the [client] section of given .cnf file
+func readCnfFileCredentials(fileName string) (string, string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	var user, password string
+	inClientSection := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inClientSection = (line == "[client]")
+			continue
+		}
+		if !inClientSection {
+			continue
+		}
+		tokens := strings.SplitN(line, "=", 2)
+		if len(tokens) != 2 {
+			continue
+		}
+		value := strings.Trim(strings.TrimSpace(tokens[1]), `"'`)
+		switch strings.TrimSpace(tokens[0]) {
+			case "user": user = value
+			case "password": password = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	if user == "" {
+		return "", "", errors.New(fmt.Sprintf("No user found in [client] section of %s", fileName))
+	}
+	return user, password, nil
+}
+
+// CredentialsMapping maps instances, by cluster name/alias or by hostname, onto credentials.
+// Credentials are either given explicitly or by a .cnf file.
+type CredentialsMapping struct {
+	ClusterPattern	string		// Regexp applied on cluster name and cluster alias
+	HostnamePattern	string		// Regexp applied on hostname
+	User			string
+	Password		string
+	CnfFile			string		// Takes precedence over User/Password
+}
+
+// compiledCredentialsMapping is a CredentialsMapping with its patterns compiled and its .cnf file, if any,
+// read once
+type compiledCredentialsMapping struct {
+	CredentialsMapping
+	clusterRegexp	*regexp.Regexp
+	hostnameRegexp	*regexp.Regexp
+	cnfFile			*cnfFileCredentials
+}
+
+// instanceClusterNames is a cached result of readInstanceClusterNames
+type instanceClusterNames struct {
+	clusterNames	[]string
+	readTime		time.Time
+}
+
+// mappedFileCredentials reads a JSON list of CredentialsMapping. The first mapping to match an instance applies;
+// instances matching no mapping use the static credentials. The file is read once.
+// Cluster names of instances are cached for InstancePollSeconds, which is how often they may change.
+type mappedFileCredentials struct {
+	fileName	string
+	once		sync.Once
+	mappings	[]compiledCredentialsMapping
+	err			error
+
+	clusterNamesMutex	sync.Mutex
+	clusterNames		map[string]instanceClusterNames
+}
+
+func (this *mappedFileCredentials) GetCredentials(host string, port int) (string, string, error) {
+	this.once.Do(func() {
+		this.mappings, this.err = readCredentialsMappings(this.fileName)
+		this.clusterNames = make(map[string]instanceClusterNames)
+	})
+	if this.err != nil {
+		return "", "", this.err
+	}
+	var clusterNames []string
+	for _, mapping := range this.mappings {
+		matched := false
+		if mapping.hostnameRegexp != nil {
+			matched = mapping.hostnameRegexp.MatchString(host)
+		}
+		if !matched && mapping.clusterRegexp != nil {
+			if clusterNames == nil {
+				clusterNames = this.getInstanceClusterNames(host, port)
+			}
+			for _, clusterName := range clusterNames {
+				if mapping.clusterRegexp.MatchString(clusterName) {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			continue
+		}
+		if mapping.cnfFile != nil {
+			return mapping.cnfFile.GetCredentials(host, port)
+		}
+		return mapping.User, mapping.Password, nil
+	}
+	return (&staticCredentials{}).GetCredentials(host, port)
+}
+
+// getInstanceClusterNames returns the cluster names of given instance, as cached or as freshly read
+func (this *mappedFileCredentials) getInstanceClusterNames(host string, port int) []string {
+	key := fmt.Sprintf("%s:%d", host, port)
+	this.clusterNamesMutex.Lock()
+	cached, found := this.clusterNames[key]
+	this.clusterNamesMutex.Unlock()
+	if found && time.Since(cached.readTime) < time.Duration(config.Config.InstancePollSeconds) * time.Second {
+		return cached.clusterNames
+	}
+
+	clusterNames := readInstanceClusterNames(host, port)
+	this.clusterNamesMutex.Lock()
+	this.clusterNames[key] = instanceClusterNames{clusterNames: clusterNames, readTime: time.Now()}
+	this.clusterNamesMutex.Unlock()
+	return clusterNames
+}
+
+// readCredentialsMappings reads, validates and compiles the JSON credentials mapping file
+func readCredentialsMappings(fileName string) ([]compiledCredentialsMapping, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mappings := []CredentialsMapping{}
+	if err := json.NewDecoder(file).Decode(&mappings); err != nil {
+		return nil, err
+	}
+	compiledMappings := []compiledCredentialsMapping{}
+	for _, mapping := range mappings {
+		compiledMapping := compiledCredentialsMapping{CredentialsMapping: mapping}
+		if mapping.ClusterPattern != "" {
+			if compiledMapping.clusterRegexp, err = regexp.Compile(mapping.ClusterPattern); err != nil {
+				return nil, err
+			}
+		}
+		if mapping.HostnamePattern != "" {
+			if compiledMapping.hostnameRegexp, err = regexp.Compile(mapping.HostnamePattern); err != nil {
+				return nil, err
+			}
+		}
+		if mapping.CnfFile != "" {
+			compiledMapping.cnfFile = &cnfFileCredentials{fileName: mapping.CnfFile}
+		}
+		compiledMappings = append(compiledMappings, compiledMapping)
+	}
+	return compiledMappings, nil
+}
+
+// readInstanceClusterNames returns the cluster name, and alias if any, of an already known instance.
+// A yet unknown instance has no cluster and can only be matched by hostname.
+func readInstanceClusterNames(host string, port int) []string {
+	clusterNames := []string{}
+	db,	err	:=	OpenOrchestrator()
+	if err != nil {
+		log.Errore(err)
+		return clusterNames
+	}
+	var clusterName, clusterAlias string
+	err = db.QueryRow(`
+		select
+			database_instance.cluster_name,
+			ifnull(cluster_alias.alias, '')
+		from
+			database_instance
+			left join cluster_alias using (cluster_name)
+		where
+			hostname = ?
+			and port = ?`,
+		host, port).Scan(
+			&clusterName,
+			&clusterAlias,
+		)
+	if err != nil {
+		return clusterNames
+	}
+	clusterNames = append(clusterNames, clusterName)
+	if clusterAlias != "" {
+		clusterNames = append(clusterNames, clusterAlias)
+	}
+	return clusterNames
+}
+
+var topologyCredentialsProvider CredentialsProvider
+var topologyCredentialsProviderMutex sync.Mutex
+
+// GetTopologyCredentialsProvider returns the provider configured by MySQLTopologyCredentialsProvider
+func GetTopologyCredentialsProvider() CredentialsProvider {
+	topologyCredentialsProviderMutex.Lock()
+	defer topologyCredentialsProviderMutex.Unlock()
+
+	if topologyCredentialsProvider == nil {
+		switch config.Config.MySQLTopologyCredentialsProvider {
+			case CnfFileCredentialsProvider: topologyCredentialsProvider = &cnfFileCredentials{fileName: config.Config.MySQLTopologyCredentialsConfigFile}
+			case EnvCredentialsProvider: topologyCredentialsProvider = &envCredentials{}
+			case MappedFileCredentialsProvider: topologyCredentialsProvider = &mappedFileCredentials{fileName: config.Config.MySQLTopologyCredentialsMappingFile}
+			default: topologyCredentialsProvider = &staticCredentials{}
+		}
+	}
+	return topologyCredentialsProvider
+}
+
+// SetTopologyCredentialsProvider overrides the configured provider
+func SetTopologyCredentialsProvider(provider CredentialsProvider) {
+	topologyCredentialsProviderMutex.Lock()
+	defer topologyCredentialsProviderMutex.Unlock()
+
+	topologyCredentialsProvider = provider
+}
@@ -18,6 +18,7 @@ package db
 
 import (
 	"fmt"
+	"strings"
 	_ "github.com/go-sql-driver/mysql"
 	"database/sql"
 	"github.com/outbrain/log"
@@ -54,10 +55,23 @@ var generateSQL = []string{
           num_slave_hosts int(10) unsigned NOT NULL,
           slave_hosts text CHARACTER SET ascii NOT NULL,
           cluster_name tinytext CHARACTER SET ascii NOT NULL,
+          data_center varchar(32) CHARACTER SET ascii NOT NULL DEFAULT '',
+          physical_environment varchar(32) CHARACTER SET ascii NOT NULL DEFAULT '',
+          is_unreachable tinyint(3) unsigned NOT NULL DEFAULT 0,
+          uses_ssl tinyint(3) unsigned NOT NULL DEFAULT 0,
+          master_ssl_allowed tinyint(3) unsigned NOT NULL DEFAULT 0,
+          last_io_errno int(10) unsigned NOT NULL DEFAULT 0,
+          last_io_error text CHARACTER SET utf8 NOT NULL,
+          last_io_error_timestamp varchar(32) CHARACTER SET ascii NOT NULL DEFAULT '',
+          last_sql_errno int(10) unsigned NOT NULL DEFAULT 0,
+          last_sql_error text CHARACTER SET utf8 NOT NULL,
+          last_sql_error_timestamp varchar(32) CHARACTER SET ascii NOT NULL DEFAULT '',
           PRIMARY KEY (hostname,port),
           KEY cluster_name_idx (cluster_name(128)),
           KEY last_checked_idx (last_checked),
-          KEY last_seen_idx (last_seen)
+          KEY last_seen_idx (last_seen),
+          KEY last_io_errno_idx (last_io_errno),
+          KEY last_sql_errno_idx (last_sql_errno)
         ) ENGINE=InnoDB DEFAULT CHARSET=ascii
 
 	`,
@@ -71,6 +85,8 @@ var generateSQL = []string{
           end_timestamp timestamp NULL DEFAULT NULL,
           owner varchar(128) CHARACTER SET utf8 NOT NULL,
           reason text CHARACTER SET utf8 NOT NULL,
+          processing_node_hostname varchar(128) CHARACTER SET ascii NOT NULL DEFAULT '',
+          processing_node_token varchar(128) NOT NULL DEFAULT '',
           PRIMARY KEY (database_instance_maintenance_id),
           UNIQUE KEY maintenance_uidx (maintenance_active,hostname,port)
         ) ENGINE=InnoDB DEFAULT CHARSET=ascii
@@ -82,47 +98,346 @@ var generateSQL = []string{
           audit_type varchar(128) CHARACTER SET ascii NOT NULL,
           hostname varchar(128) CHARACTER SET ascii NOT NULL DEFAULT '',
           port smallint(5) unsigned NOT NULL,
+          owner varchar(128) CHARACTER SET utf8 NOT NULL DEFAULT '',
           message text CHARACTER SET utf8 NOT NULL,
           PRIMARY KEY (audit_id),
           KEY audit_timestamp_idx (audit_timestamp),
           KEY host_port_idx (hostname,port,audit_timestamp)
         ) ENGINE=InnoDB AUTO_INCREMENT=25 DEFAULT CHARSET=latin1 
 	`,	
+	`
+        CREATE TABLE IF NOT EXISTS hostname_alias (
+          alias varchar(128) CHARACTER SET ascii NOT NULL,
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          last_registered timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          PRIMARY KEY (alias),
+          KEY hostname_idx (hostname)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS discovery_seed (
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          port smallint(5) unsigned NOT NULL,
+          seed_source varchar(32) CHARACTER SET ascii NOT NULL,
+          first_seen timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          last_seen timestamp NULL DEFAULT NULL,
+          removed_timestamp timestamp NULL DEFAULT NULL,
+          PRIMARY KEY (hostname,port)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS cluster_alias (
+          cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+          alias varchar(128) NOT NULL,
+          last_registered timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          PRIMARY KEY (cluster_name),
+          UNIQUE KEY alias_uidx (alias)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS database_instance_tags (
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          port smallint(5) unsigned NOT NULL,
+          tag_name varchar(128) CHARACTER SET utf8 NOT NULL,
+          tag_value varchar(128) CHARACTER SET utf8 NOT NULL,
+          last_updated timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          PRIMARY KEY (hostname,port,tag_name),
+          KEY tag_name_idx (tag_name)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS candidate_database_instance (
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          port smallint(5) unsigned NOT NULL,
+          promotion_rule enum('prefer', 'neutral', 'prefer_not', 'must_not') CHARACTER SET ascii NOT NULL DEFAULT 'neutral',
+          last_suggested timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          PRIMARY KEY (hostname,port),
+          KEY last_suggested_idx (last_suggested)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS database_instance_topology_history (
+          snapshot_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          port smallint(5) unsigned NOT NULL,
+          last_checked timestamp NULL DEFAULT NULL,
+          last_seen timestamp NULL DEFAULT NULL,
+          server_id int(10) unsigned NOT NULL,
+          version varchar(128) CHARACTER SET ascii NOT NULL,
+          binlog_format varchar(16) CHARACTER SET ascii NOT NULL,
+          log_bin tinyint(3) unsigned NOT NULL,
+          log_slave_updates tinyint(3) unsigned NOT NULL,
+          master_host varchar(128) CHARACTER SET ascii NOT NULL,
+          master_port smallint(5) unsigned NOT NULL,
+          slave_sql_running tinyint(3) unsigned NOT NULL,
+          slave_io_running tinyint(3) unsigned NOT NULL,
+          seconds_behind_master bigint(20) unsigned DEFAULT NULL,
+          slave_lag_seconds bigint(20) unsigned DEFAULT NULL,
+          slave_hosts text CHARACTER SET ascii NOT NULL,
+          cluster_name tinytext CHARACTER SET ascii NOT NULL,
+          data_center varchar(32) CHARACTER SET ascii NOT NULL DEFAULT '',
+          physical_environment varchar(32) CHARACTER SET ascii NOT NULL DEFAULT '',
+          PRIMARY KEY (snapshot_timestamp,hostname,port),
+          KEY cluster_name_idx (cluster_name(128),snapshot_timestamp)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS database_instance_event (
+          event_id bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+          event_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          port smallint(5) unsigned NOT NULL,
+          event_type varchar(64) CHARACTER SET ascii NOT NULL,
+          old_value varchar(255) CHARACTER SET ascii NOT NULL DEFAULT '',
+          new_value varchar(255) CHARACTER SET ascii NOT NULL DEFAULT '',
+          PRIMARY KEY (event_id),
+          KEY event_timestamp_idx (event_timestamp),
+          KEY host_port_idx (hostname,port,event_id)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS database_instance_downtime (
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          port smallint(5) unsigned NOT NULL,
+          begin_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          end_timestamp timestamp NULL DEFAULT NULL,
+          owner varchar(128) CHARACTER SET utf8 NOT NULL,
+          reason text CHARACTER SET utf8 NOT NULL,
+          PRIMARY KEY (hostname,port),
+          KEY end_timestamp_idx (end_timestamp)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS node_health (
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          token varchar(128) NOT NULL,
+          is_discovery_node tinyint(3) unsigned NOT NULL DEFAULT 0,
+          first_seen_active timestamp NULL DEFAULT NULL,
+          last_seen_active timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          PRIMARY KEY (hostname,token),
+          KEY last_seen_active_idx (last_seen_active)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS active_node (
+          anchor tinyint(3) unsigned NOT NULL,
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          token varchar(128) NOT NULL,
+          first_seen_active timestamp NULL DEFAULT NULL,
+          last_seen_active timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          PRIMARY KEY (anchor)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS database_instance_lag_history (
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          port smallint(5) unsigned NOT NULL,
+          sample_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+          seconds_behind_master bigint(20) unsigned DEFAULT NULL,
+          slave_lag_seconds bigint(20) unsigned DEFAULT NULL,
+          master_log_file varchar(128) CHARACTER SET ascii NOT NULL,
+          read_master_log_pos bigint(20) unsigned NOT NULL,
+          relay_master_log_file varchar(128) CHARACTER SET ascii NOT NULL,
+          exec_master_log_pos bigint(20) unsigned NOT NULL,
+          PRIMARY KEY (hostname,port,sample_timestamp),
+          KEY cluster_name_idx (cluster_name,sample_timestamp),
+          KEY sample_timestamp_idx (sample_timestamp)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS database_instance_discovery_timing (
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          port smallint(5) unsigned NOT NULL,
+          timing_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          total_millis double NOT NULL,
+          phase_millis text CHARACTER SET ascii NOT NULL,
+          PRIMARY KEY (hostname,port,timing_timestamp)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS orchestrator_schema_migration (
+          version int(10) unsigned NOT NULL,
+          description varchar(255) CHARACTER SET utf8 NOT NULL,
+          applied_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          PRIMARY KEY (version)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+        CREATE TABLE IF NOT EXISTS orchestrator_schema_migration_lock (
+          anchor tinyint(3) unsigned NOT NULL,
+          hostname varchar(128) CHARACTER SET ascii NOT NULL,
+          token varchar(128) NOT NULL,
+          lock_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          PRIMARY KEY (anchor)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
 }
 
+// schemaMigrations is the ordered list of changes to tables in generateSQL, applied once each on top of
+// installations which predate them. Tables above are always created in their latest form, so a migration
+// adding an already existing column or key is considered applied. Append only; never edit or reorder.
+var schemaMigrations = []SchemaMigration{
+	{1, "database_instance: add data_center", `
+		ALTER TABLE database_instance ADD COLUMN data_center varchar(32) CHARACTER SET ascii NOT NULL DEFAULT ''
+	`},
+	{2, "database_instance: add physical_environment", `
+		ALTER TABLE database_instance ADD COLUMN physical_environment varchar(32) CHARACTER SET ascii NOT NULL DEFAULT ''
+	`},
+	{3, "database_instance: add is_unreachable", `
+		ALTER TABLE database_instance ADD COLUMN is_unreachable tinyint(3) unsigned NOT NULL DEFAULT 0
+	`},
+	{4, "database_instance: add uses_ssl", `
+		ALTER TABLE database_instance ADD COLUMN uses_ssl tinyint(3) unsigned NOT NULL DEFAULT 0
+	`},
+	{5, "database_instance: add master_ssl_allowed", `
+		ALTER TABLE database_instance ADD COLUMN master_ssl_allowed tinyint(3) unsigned NOT NULL DEFAULT 0
+	`},
+	{6, "database_instance: add last_io_errno", `
+		ALTER TABLE database_instance ADD COLUMN last_io_errno int(10) unsigned NOT NULL DEFAULT 0
+	`},
+	{7, "database_instance: add last_io_error", `
+		ALTER TABLE database_instance ADD COLUMN last_io_error text CHARACTER SET utf8 NOT NULL
+	`},
+	{8, "database_instance: add last_io_error_timestamp", `
+		ALTER TABLE database_instance ADD COLUMN last_io_error_timestamp varchar(32) CHARACTER SET ascii NOT NULL DEFAULT ''
+	`},
+	{9, "database_instance: add last_sql_errno", `
+		ALTER TABLE database_instance ADD COLUMN last_sql_errno int(10) unsigned NOT NULL DEFAULT 0
+	`},
+	{10, "database_instance: add last_sql_error", `
+		ALTER TABLE database_instance ADD COLUMN last_sql_error text CHARACTER SET utf8 NOT NULL
+	`},
+	{11, "database_instance: add last_sql_error_timestamp", `
+		ALTER TABLE database_instance ADD COLUMN last_sql_error_timestamp varchar(32) CHARACTER SET ascii NOT NULL DEFAULT ''
+	`},
+	{12, "database_instance: add last_io_errno_idx", `
+		ALTER TABLE database_instance ADD KEY last_io_errno_idx (last_io_errno)
+	`},
+	{13, "database_instance: add last_sql_errno_idx", `
+		ALTER TABLE database_instance ADD KEY last_sql_errno_idx (last_sql_errno)
+	`},
+	{14, "database_instance_maintenance: add processing_node_hostname", `
+		ALTER TABLE database_instance_maintenance ADD COLUMN processing_node_hostname varchar(128) CHARACTER SET ascii NOT NULL DEFAULT ''
+	`},
+	{15, "database_instance_maintenance: add processing_node_token", `
+		ALTER TABLE database_instance_maintenance ADD COLUMN processing_node_token varchar(128) NOT NULL DEFAULT ''
+	`},
+	{16, "node_health: add is_discovery_node", `
+		ALTER TABLE node_health ADD COLUMN is_discovery_node tinyint(3) unsigned NOT NULL DEFAULT 0
+	`},
+	{17, "audit: add owner", `
+		ALTER TABLE audit ADD COLUMN owner varchar(128) CHARACTER SET utf8 NOT NULL DEFAULT ''
+	`},
+}
+
+
+// dsnParams returns the DSN parameters part (e.g. "?timeout=2s&readTimeout=30s") for given connection settings.
+// Zero timeouts are omitted, leaving the driver's defaults. An empty TLS config name means plain text connection.
+func dsnParams(connectTimeoutSeconds uint, readTimeoutSeconds uint, tlsConfigName string) string {
+	params := []string{}
+	if tlsConfigName != "" {
+		params = append(params, fmt.Sprintf("tls=%s", tlsConfigName))
+	}
+	if connectTimeoutSeconds > 0 {
+		params = append(params, fmt.Sprintf("timeout=%ds", connectTimeoutSeconds))
+	}
+	if readTimeoutSeconds > 0 {
+		params = append(params, fmt.Sprintf("readTimeout=%ds", readTimeoutSeconds), fmt.Sprintf("writeTimeout=%ds", readTimeoutSeconds))
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "?" + strings.Join(params, "&")
+}
 
 // OpenTopology returns a DB instance to access a topology instance
 func OpenTopology(host string, port int) (*sql.DB, error) {
-	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/", config.Config.MySQLTopologyUser, config.Config.MySQLTopologyPassword, host, port)
+	tlsConfigName := ""
+	if config.Config.MySQLTopologyUseSSL {
+		err := registerTLSConfig(topologyTLSConfigName, config.Config.MySQLTopologySSLCAFile, config.Config.MySQLTopologySSLCertFile,
+			config.Config.MySQLTopologySSLPrivateKeyFile, config.Config.MySQLTopologySSLSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfigName = topologyTLSConfigName
+	}
+	user, password, err := GetTopologyCredentialsProvider().GetCredentials(host, port)
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", user, password, host, port,
+		dsnParams(config.Config.MySQLTopologyConnectTimeoutSeconds, config.Config.MySQLTopologyReadTimeoutSeconds, tlsConfigName))
 	db, _, err := sqlutils.GetDB(mysql_uri)
 	return db, err
 }
 
 // OpenTopology returns the DB instance for the orchestrator backed database
 func OpenOrchestrator() (*sql.DB, error) {
-	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", config.Config.MySQLOrchestratorUser, config.Config.MySQLOrchestratorPassword, 
-		config.Config.MySQLOrchestratorHost, config.Config.MySQLOrchestratorPort, config.Config.MySQLOrchestratorDatabase)
-	db, fromCache, err := sqlutils.GetDB(mysql_uri)
+	db, fromCache, err := openOrchestratorDB()
 	if err == nil && !fromCache {
 		initOrchestratorDB(db)
 	}
 	return db, err
 }
 
+// openOrchestratorDB returns the DB instance for the orchestrator backed database, without creating or
+// migrating its schema. bool result indicates whether the DB was returned from cache.
+func openOrchestratorDB() (*sql.DB, bool, error) {
+	if config.Config.IsSQLite() {
+		return openOrchestratorSQLite()
+	}
+	tlsConfigName := ""
+	if config.Config.MySQLOrchestratorUseSSL {
+		err := registerTLSConfig(orchestratorTLSConfigName, config.Config.MySQLOrchestratorSSLCAFile, config.Config.MySQLOrchestratorSSLCertFile,
+			config.Config.MySQLOrchestratorSSLPrivateKeyFile, config.Config.MySQLOrchestratorSSLSkipVerify)
+		if err != nil {
+			return nil, false, err
+		}
+		tlsConfigName = orchestratorTLSConfigName
+	}
+	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s%s", config.Config.MySQLOrchestratorUser, config.Config.MySQLOrchestratorPassword, 
+		config.Config.MySQLOrchestratorHost, config.Config.MySQLOrchestratorPort, config.Config.MySQLOrchestratorDatabase,
+		dsnParams(config.Config.MySQLOrchestratorConnectTimeoutSeconds, config.Config.MySQLOrchestratorReadTimeoutSeconds, tlsConfigName))
+	return sqlutils.GetDB(mysql_uri)
+}
+
+// openOrchestratorSQLite returns the DB instance for an embedded SQLite orchestrator backend
+func openOrchestratorSQLite() (*sql.DB, bool, error) {
+	if config.Config.SQLite3DataFile == "" {
+		return nil, false, log.Errorf("SQLite3DataFile must be set when BackendDB is %s", config.Config.BackendDB)
+	}
+	dataSourceName := fmt.Sprintf("%s?_busy_timeout=%d", config.Config.SQLite3DataFile, sqliteBusyTimeoutMilliseconds)
+	return sqlutils.GetGenericDB(sqliteDriverName, dataSourceName)
+}
+
 
 // initOrchestratorDB attempts to create/upgrade the orchestrator backend database. It is created once in the
-// application's lifetime. 
+// application's lifetime. The process bails out if the backend's schema is newer than this binary's.
 func initOrchestratorDB(db *sql.DB) error {
 	log.Debug("Initializing orchestrator")
 	for _, query := range generateSQL {
-		_, err := ExecOrchestrator(query)
-		if err != nil { 
-			return log.Fatalf("Cannot initiate orchestrator: %+v", err) 
+		for _, query := range toDialectStatements(query) {
+			_, err := ExecOrchestrator(query)
+			if err != nil { 
+				return log.Fatalf("Cannot initiate orchestrator: %+v", err) 
+			}
 		}
 	}
+	if err := migrateOrchestratorDB(db); err != nil {
+		return log.Fatalf("Cannot migrate orchestrator: %+v", err) 
+	}
 	return nil
 }
 
+// toDialectStatements returns the statements implementing given DDL statement on the configured backend
+func toDialectStatements(statement string) []string {
+	if config.Config.IsSQLite() {
+		return toSQLiteStatements(statement)
+	}
+	return []string{statement}
+}
+
 
 // ExecOrchestrator will execute given query on the orchestrator backend database.
 func ExecOrchestrator(query string, args ...interface{}) (sql.Result, error) {
@@ -0,0 +1,205 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"database/sql"
+	"github.com/outbrain/log"
+	"github.com/outbrain/sqlutils"
+)
+
+const (
+	// schemaMigrationLockWaitSeconds is the time a process waits for another process to complete migrations
+	schemaMigrationLockWaitSeconds = 120
+	// schemaMigrationLockExpireSeconds is the age after which a lock is considered abandoned (e.g. its process crashed)
+	schemaMigrationLockExpireSeconds = 600
+)
+
+// SchemaMigration is a single versioned change to the backend schema. Versions are consecutive, starting with 1.
+type SchemaMigration struct {
+	Version		int
+	Description	string
+	Statement	string
+}
+
+// SchemaMigrationStatus tells whether a migration has been applied on the backend, and when.
+type SchemaMigrationStatus struct {
+	SchemaMigration
+	IsApplied			bool
+	AppliedTimestamp	string
+}
+
+var schemaMigrationLockToken = fmt.Sprintf("%d:%d", os.Getpid(), time.Now().UnixNano())
+
+// SchemaVersion returns the schema version this binary migrates the backend to
+func SchemaVersion() int {
+	return len(schemaMigrations)
+}
+
+// isAppliedMigrationError tells whether given error indicates the migration's change is already in place
+func isAppliedMigrationError(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "duplicate column name") || strings.Contains(message, "duplicate key name")
+}
+
+// readSchemaVersion returns the latest migration applied on the backend
+func readSchemaVersion(db *sql.DB) (int, error) {
+	schemaVersion := 0
+	err := sqlutils.QueryRowsMap(db, `
+		select
+			ifnull(max(version), 0) as schema_version
+		from
+			orchestrator_schema_migration
+		`, func(m sqlutils.RowMap) error {
+		schemaVersion = m.GetInt("schema_version")
+		return nil
+	})
+	return schemaVersion, err
+}
+
+// acquireSchemaMigrationLock blocks until this process is the only one migrating the backend
+func acquireSchemaMigrationLock(db *sql.DB) error {
+	hostname, _ := os.Hostname()
+	for i := 0; i < schemaMigrationLockWaitSeconds; i++ {
+		_, err := sqlutils.Exec(db, `
+				delete from orchestrator_schema_migration_lock
+				where
+					anchor = 1
+					and lock_timestamp < NOW() - interval ? second
+				`,
+				schemaMigrationLockExpireSeconds,
+			 )
+		if err != nil {return log.Errore(err)}
+
+		res, err := sqlutils.Exec(db, `
+				insert ignore
+					into orchestrator_schema_migration_lock (
+						anchor, hostname, token, lock_timestamp
+					) VALUES (
+						1, ?, ?, NOW()
+					)
+				`,
+				hostname,
+				schemaMigrationLockToken,
+			 )
+		if err != nil {return log.Errore(err)}
+		if rows, _ := res.RowsAffected(); rows > 0 {
+			return nil
+		}
+		if i == 0 {
+			log.Infof("Waiting for another orchestrator process to complete schema migrations")
+		}
+		time.Sleep(time.Second)
+	}
+	return log.Errorf("Timed out waiting on schema migration lock")
+}
+
+// releaseSchemaMigrationLock lets other processes migrate the backend
+func releaseSchemaMigrationLock(db *sql.DB) error {
+	_, err := sqlutils.Exec(db, `
+			delete from orchestrator_schema_migration_lock
+			where
+				anchor = 1
+				and token = ?
+			`,
+			schemaMigrationLockToken,
+		 )
+	return err
+}
+
+// migrateOrchestratorDB applies, once each and in order, those migrations not yet applied on the backend.
+// It refuses a backend whose schema is newer than this binary's.
+func migrateOrchestratorDB(db *sql.DB) error {
+	schemaVersion, err := readSchemaVersion(db)
+	if err != nil {return log.Errore(err)}
+	if schemaVersion > SchemaVersion() {
+		return log.Errorf("Backend schema version %d is newer than this binary's %d. Refusing to run with an older binary", schemaVersion, SchemaVersion())
+	}
+	if schemaVersion == SchemaVersion() {
+		return nil
+	}
+
+	if err := acquireSchemaMigrationLock(db); err != nil {
+		return err
+	}
+	defer releaseSchemaMigrationLock(db)
+
+	// Another process may have migrated while we waited on the lock
+	if schemaVersion, err = readSchemaVersion(db); err != nil {
+		return log.Errore(err)
+	}
+	if schemaVersion > SchemaVersion() {
+		return log.Errorf("Backend schema version %d is newer than this binary's %d. Refusing to run with an older binary", schemaVersion, SchemaVersion())
+	}
+	for _, migration := range schemaMigrations[schemaVersion:] {
+		for _, statement := range toDialectStatements(migration.Statement) {
+			if _, err := sqlutils.Exec(db, statement); err != nil && !isAppliedMigrationError(err) {
+				return log.Errorf("Schema migration %d (%s) failed: %+v", migration.Version, migration.Description, err)
+			}
+		}
+		_, err := sqlutils.Exec(db, `
+				insert
+					into orchestrator_schema_migration (
+						version, description, applied_timestamp
+					) VALUES (
+						?, ?, NOW()
+					)
+				`,
+				migration.Version,
+				migration.Description,
+			 )
+		if err != nil {return log.Errore(err)}
+		log.Infof("Applied schema migration %d: %s", migration.Version, migration.Description)
+	}
+	return nil
+}
+
+// ReadSchemaMigrationStatus returns the backend's schema version along with the status of each migration known
+// to this binary. It does not create nor migrate the schema.
+func ReadSchemaMigrationStatus() (int, []SchemaMigrationStatus, error) {
+	res := []SchemaMigrationStatus{}
+	for _, migration := range schemaMigrations {
+		res = append(res, SchemaMigrationStatus{SchemaMigration: migration})
+	}
+	db, _, err := openOrchestratorDB()
+	if err != nil {return 0, res, log.Errore(err)}
+
+	schemaVersion, err := readSchemaVersion(db)
+	if err != nil {return 0, res, log.Errore(err)}
+
+	err = sqlutils.QueryRowsMap(db, `
+		select
+			version,
+			applied_timestamp
+		from
+			orchestrator_schema_migration
+		order by
+			version
+		`, func(m sqlutils.RowMap) error {
+		version := m.GetInt("version")
+		if version >= 1 && version <= len(res) {
+			res[version-1].IsApplied = true
+			res[version-1].AppliedTimestamp = m.GetString("applied_timestamp")
+		}
+		return nil
+	})
+	return schemaVersion, res, err
+}
@@ -0,0 +1,196 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriverName is the driver through which the SQLite backend is accessed. It translates the
+// MySQL dialect used throughout orchestrator's DAOs into SQLite's.
+const sqliteDriverName = "sqlite3-orchestrator"
+
+// sqliteBusyTimeoutMilliseconds is the time a connection waits on a locked database before failing
+const sqliteBusyTimeoutMilliseconds = 10000
+
+type regexpReplacement struct {
+	regexp		*regexp.Regexp
+	replacement	string
+}
+
+func newRegexpReplacement(expr string, replacement string) regexpReplacement {
+	return regexpReplacement{regexp: regexp.MustCompile(expr), replacement: replacement}
+}
+
+// sqliteDMLReplacements translate MySQL specific syntax, in order
+var sqliteDMLReplacements = []regexpReplacement{
+	newRegexpReplacement(`(?i)\binsert\s+ignore\b`, `insert or ignore`),
+	newRegexpReplacement(`(?i)\bon\s+duplicate\s+key\s+update\b`, `on conflict do update set`),
+	newRegexpReplacement(`(?i)\bvalues\((\w+)\)`, `excluded.$1`),
+	newRegexpReplacement(`(?i)\btimestampdiff\(\s*second\s*,\s*([\w.]+|now\(\))\s*,\s*([\w.]+|now\(\))\s*\)`,
+		`(cast(strftime('%s', $2) as integer) - cast(strftime('%s', $1) as integer))`),
+	newRegexpReplacement(`(?i)\bunix_timestamp\(([\w.]+)\)`, `cast(strftime('%s', $1) as integer)`),
+	newRegexpReplacement(`(?i)\bnow\(\)\s*([-+])\s*interval\s+(\?|\d+)\s+(second|minute|hour|day)\b`, `datetime('now', printf('${1}%d $3', $2))`),
+	newRegexpReplacement(`(?i)\bnow\(\)`, `datetime('now')`),
+	newRegexpReplacement(`(?i)\bif\s*\(`, `iif(`),
+	newRegexpReplacement(`(?i)\bgreatest\(`, `max(`),
+}
+
+// sqliteColumnReplacements translate MySQL column definitions
+var sqliteColumnReplacements = []regexpReplacement{
+	newRegexpReplacement(`(?i)\s+character set \w+`, ``),
+	newRegexpReplacement(`(?i)\s+unsigned\b`, ``),
+	newRegexpReplacement(`(?i)\benum\([^)]*\)`, `varchar(128)`),
+	// Timestamps are kept as 'YYYY-MM-DD HH:MM:SS' text, as with MySQL; the driver would otherwise reformat them
+	newRegexpReplacement(`(?i)^(\s*\w+)\s+timestamp\b`, `$1 text`),
+}
+
+var (
+	createTableRegexp	= regexp.MustCompile(`(?i)^\s*create\s+table\s+if\s+not\s+exists\s+(\w+)`)
+	addColumnRegexp		= regexp.MustCompile(`(?is)^\s*alter\s+table\s+(\w+)\s+add\s+column\s+(.*?)\s*$`)
+	addKeyRegexp		= regexp.MustCompile(`(?is)^\s*alter\s+table\s+(\w+)\s+add\s+(?:key|index)\s+(\w+)\s+\((.*)\)\s*$`)
+	autoIncrementRegexp	= regexp.MustCompile(`(?i)^\s*(\w+)\s+\w+(\(\d+\))?(\s+unsigned)?\s+not\s+null\s+auto_increment\s*,?\s*$`)
+	primaryKeyRegexp	= regexp.MustCompile(`(?i)^\s*primary\s+key\s+\((\w+)\)\s*,?\s*$`)
+	uniqueKeyRegexp		= regexp.MustCompile(`(?i)^\s*unique\s+key\s+\w+\s+\((.*)\)\s*,?\s*$`)
+	keyRegexp			= regexp.MustCompile(`(?i)^\s*key\s+(\w+)\s+\((.*)\)\s*,?\s*$`)
+	tableOptionsRegexp	= regexp.MustCompile(`(?i)^\s*\)\s*engine\s*=.*$`)
+	prefixLengthRegexp	= regexp.MustCompile(`\(\d+\)`)
+	trailingCommaRegexp	= regexp.MustCompile(`,(\s*\)\s*)$`)
+)
+
+// ToSQLiteDialect translates a MySQL flavored statement, as used by orchestrator's DAOs, into SQLite dialect
+func ToSQLiteDialect(statement string) string {
+	for _, replacement := range sqliteDMLReplacements {
+		statement = replacement.regexp.ReplaceAllString(statement, replacement.replacement)
+	}
+	return statement
+}
+
+// toSQLiteStatements translates a MySQL DDL statement into SQLite statements. A CREATE TABLE is translated
+// into the table itself followed by its secondary indexes; ALTER TABLE may add a single column or key.
+// Other statements are returned as they are.
+func toSQLiteStatements(statement string) []string {
+	if submatch := addColumnRegexp.FindStringSubmatch(statement); submatch != nil {
+		columnDefinition := submatch[2]
+		for _, replacement := range sqliteColumnReplacements {
+			columnDefinition = replacement.regexp.ReplaceAllString(columnDefinition, replacement.replacement)
+		}
+		return []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", submatch[1], columnDefinition)}
+	}
+	if submatch := addKeyRegexp.FindStringSubmatch(statement); submatch != nil {
+		return []string{fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_%s ON %s (%s)",
+			submatch[1], submatch[2], submatch[1], prefixLengthRegexp.ReplaceAllString(submatch[3], ""))}
+	}
+	submatch := createTableRegexp.FindStringSubmatch(statement)
+	if submatch == nil {
+		return []string{statement}
+	}
+	tableName := submatch[1]
+
+	lines := []string{}
+	indexes := []string{}
+	autoIncrementColumn := ""
+	for _, line := range strings.Split(strings.TrimSpace(statement), "\n") {
+		if submatch := autoIncrementRegexp.FindStringSubmatch(line); submatch != nil {
+			autoIncrementColumn = submatch[1]
+			lines = append(lines, fmt.Sprintf("%s integer PRIMARY KEY AUTOINCREMENT,", autoIncrementColumn))
+			continue
+		}
+		if submatch := primaryKeyRegexp.FindStringSubmatch(line); submatch != nil && submatch[1] == autoIncrementColumn {
+			continue
+		}
+		if submatch := uniqueKeyRegexp.FindStringSubmatch(line); submatch != nil {
+			lines = append(lines, fmt.Sprintf("UNIQUE (%s),", prefixLengthRegexp.ReplaceAllString(submatch[1], "")))
+			continue
+		}
+		if submatch := keyRegexp.FindStringSubmatch(line); submatch != nil {
+			indexes = append(indexes, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_%s ON %s (%s)",
+				tableName, submatch[1], tableName, prefixLengthRegexp.ReplaceAllString(submatch[2], "")))
+			continue
+		}
+		if tableOptionsRegexp.MatchString(line) {
+			line = ")"
+		}
+		for _, replacement := range sqliteColumnReplacements {
+			line = replacement.regexp.ReplaceAllString(line, replacement.replacement)
+		}
+		lines = append(lines, line)
+	}
+	createTable := trailingCommaRegexp.ReplaceAllString(strings.Join(lines, "\n"), "$1")
+	return append([]string{createTable}, indexes...)
+}
+
+// registerMySQLFunctions provides SQLite with MySQL functions used by the DAOs which have no SQLite equivalent
+func registerMySQLFunctions(conn *sqlite3.SQLiteConn) error {
+	if err := conn.RegisterFunc("concat", func(args ...interface{}) string {
+		tokens := []string{}
+		for _, arg := range args {
+			if bytes, ok := arg.([]byte); ok {
+				arg = string(bytes)
+			}
+			tokens = append(tokens, fmt.Sprintf("%v", arg))
+		}
+		return strings.Join(tokens, "")
+	}, true); err != nil {
+		return err
+	}
+	if err := conn.RegisterFunc("floor", func(value float64) int64 {
+		return int64(math.Floor(value))
+	}, true); err != nil {
+		return err
+	}
+	if err := conn.RegisterFunc("from_unixtime", func(value int64) string {
+		return time.Unix(value, 0).UTC().Format("2006-01-02 15:04:05")
+	}, true); err != nil {
+		return err
+	}
+	return nil
+}
+
+// sqliteDialectDriver wraps the SQLite driver such that all statements are translated from MySQL dialect
+type sqliteDialectDriver struct {
+	driver.Driver
+}
+
+func (this *sqliteDialectDriver) Open(name string) (driver.Conn, error) {
+	conn, err := this.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteDialectConn{conn}, nil
+}
+
+// sqliteDialectConn only exposes Prepare (and not the direct Exec/Query paths), so that every statement
+// goes through translation
+type sqliteDialectConn struct {
+	driver.Conn
+}
+
+func (this *sqliteDialectConn) Prepare(query string) (driver.Stmt, error) {
+	return this.Conn.Prepare(ToSQLiteDialect(query))
+}
+
+func init() {
+	sql.Register(sqliteDriverName, &sqliteDialectDriver{&sqlite3.SQLiteDriver{ConnectHook: registerMySQLFunctions}})
+}
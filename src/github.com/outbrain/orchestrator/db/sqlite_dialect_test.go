@@ -0,0 +1,65 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"testing"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+
+func (s *TestSuite) TestToSQLiteDialect(c *C) {
+	c.Assert(ToSQLiteDialect("insert ignore into t (a) values (?)"), Equals, "insert or ignore into t (a) values (?)")
+	c.Assert(ToSQLiteDialect("insert into t (a, b) values (?, ?) on duplicate key update b = values(b)"), Equals,
+		"insert into t (a, b) values (?, ?) on conflict do update set b = excluded.b")
+	c.Assert(ToSQLiteDialect("select 1 from t where ts < NOW() - interval ? hour"), Equals,
+		"select 1 from t where ts < datetime('now', printf('-%d hour', ?))")
+	c.Assert(ToSQLiteDialect("select timestampdiff(second, last_checked, now()) from t"), Equals,
+		"select (cast(strftime('%s', datetime('now')) as integer) - cast(strftime('%s', last_checked) as integer)) from t")
+	c.Assert(ToSQLiteDialect("update t set a = if(b = ?, a, NOW()), c = greatest(c, 0)"), Equals,
+		"update t set a = iif(b = ?, a, datetime('now')), c = max(c, 0)")
+	c.Assert(ToSQLiteDialect("select if (a != '', a, b) from t"), Equals, "select iif(a != '', a, b) from t")
+	c.Assert(ToSQLiteDialect("select ifnull(a, '') from t"), Equals, "select ifnull(a, '') from t")
+}
+
+func (s *TestSuite) TestToSQLiteStatements(c *C) {
+	statements := toSQLiteStatements(`
+        CREATE TABLE IF NOT EXISTS audit (
+          audit_id bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+          audit_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+          hostname varchar(128) CHARACTER SET ascii NOT NULL DEFAULT '',
+          PRIMARY KEY (audit_id),
+          KEY host_idx (hostname(64),audit_timestamp)
+        ) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`)
+	c.Assert(len(statements), Equals, 2)
+	c.Assert(statements[0], Matches, `(?s).*audit_id integer PRIMARY KEY AUTOINCREMENT,.*`)
+	c.Assert(statements[0], Matches, `(?s).*audit_timestamp text NOT NULL DEFAULT CURRENT_TIMESTAMP,.*`)
+	c.Assert(statements[0], Matches, `(?s).*hostname varchar\(128\) NOT NULL DEFAULT ''\n\)`)
+	c.Assert(statements[1], Equals, "CREATE INDEX IF NOT EXISTS audit_host_idx ON audit (hostname,audit_timestamp)")
+
+	c.Assert(toSQLiteStatements("ALTER TABLE audit ADD COLUMN owner varchar(128) CHARACTER SET utf8 NOT NULL DEFAULT ''"), DeepEquals,
+		[]string{"ALTER TABLE audit ADD COLUMN owner varchar(128) NOT NULL DEFAULT ''"})
+	c.Assert(toSQLiteStatements("ALTER TABLE audit ADD KEY owner_idx (owner)"), DeepEquals,
+		[]string{"CREATE INDEX IF NOT EXISTS audit_owner_idx ON audit (owner)"})
+}
@@ -0,0 +1,82 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"io/ioutil"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/go-sql-driver/mysql"
+	"github.com/outbrain/log"
+)
+
+const (
+	topologyTLSConfigName = "orchestrator-topology"
+	orchestratorTLSConfigName = "orchestrator-backend"
+)
+
+// registeredTLSConfigs lists the TLS config names already registered with the MySQL driver
+var registeredTLSConfigs map[string]bool = make(map[string]bool)
+var registeredTLSConfigsMutex sync.Mutex
+
+// newTLSConfig builds a client TLS configuration. The CA file is optional (system CAs are used otherwise);
+// so are the certificate and key files, which are only required when the server expects client certificates.
+func newTLSConfig(caFile string, certFile string, keyFile string, skipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: skipVerify}
+	if caFile != "" {
+		caPEM, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		rootCertPool := x509.NewCertPool()
+		if !rootCertPool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New(fmt.Sprintf("Cannot parse CA file: %s", caFile))
+		}
+		tlsConfig.RootCAs = rootCertPool
+	}
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// registerTLSConfig registers a TLS configuration with the MySQL driver, once per name, so that
+// it can be referred to by the "tls" DSN parameter
+func registerTLSConfig(name string, caFile string, certFile string, keyFile string, skipVerify bool) error {
+	registeredTLSConfigsMutex.Lock()
+	defer registeredTLSConfigsMutex.Unlock()
+
+	if registeredTLSConfigs[name] {
+		return nil
+	}
+	tlsConfig, err := newTLSConfig(caFile, certFile, keyFile, skipVerify)
+	if err != nil {
+		return log.Errore(err)
+	}
+	if err := mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return log.Errore(err)
+	}
+	registeredTLSConfigs[name] = true
+	return nil
+}
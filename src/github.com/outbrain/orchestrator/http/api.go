@@ -20,12 +20,15 @@ import (
 	"net/http"	
 	"fmt"
 	"strconv"	
+	"time"
 	"encoding/json"
 	"github.com/go-martini/martini"
 	"github.com/martini-contrib/render"
 
+	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/orchestrator/inst"
 	"github.com/outbrain/orchestrator/logic"
+	"github.com/outbrain/orchestrator/process"
 )
 
 type HttpAPI struct{}
@@ -129,7 +132,8 @@ func (this *HttpAPI) Forget(params martini.Params, r render.Render) {
 }
 
 
-// BeginMaintenance begins maintenance mode for given instance
+// BeginMaintenance begins maintenance mode for given instance, for given duration (e.g. "30m", "4h";
+// optional, defaults to ManualMaintenanceExpireMinutes)
 func (this *HttpAPI) BeginMaintenance(params martini.Params, r render.Render) {
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
@@ -137,7 +141,14 @@ func (this *HttpAPI) BeginMaintenance(params martini.Params, r render.Render) {
 		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
 		return
 	}
-	key, err := inst.BeginMaintenance(&instanceKey, params["owner"], params["reason"])
+	duration := time.Duration(config.Config.ManualMaintenanceExpireMinutes) * time.Minute
+	if params["duration"] != "" {
+		if duration, err = time.ParseDuration(params["duration"]); err != nil {
+			r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+			return
+		}
+	}
+	key, err := inst.BeginBoundedMaintenance(&instanceKey, params["owner"], params["reason"], duration, false)
 	if err != nil {
 		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(), Details: key,})
 		return
@@ -195,15 +206,79 @@ func (this *HttpAPI) Maintenance(params martini.Params, r render.Render) {
 }
 
 
+// BeginDowntime downtimes given instance for given duration (e.g. "30m", "4h")
+func (this *HttpAPI) BeginDowntime(params martini.Params, r render.Render) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	duration, err := time.ParseDuration(params["duration"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	err = inst.BeginDowntime(&instanceKey, params["owner"], params["reason"], duration)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code:OK, Message: fmt.Sprintf("Downtime begun: %+v", instanceKey),})
+}
+
+
+// EndDowntime terminates downtime for given instance
+func (this *HttpAPI) EndDowntime(params martini.Params, r render.Render) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	err = inst.EndDowntime(&instanceKey)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code:OK, Message: fmt.Sprintf("Downtime ended: %+v", instanceKey),})
+}
+
+
+// Downtimed provides list of downtimed instances
+func (this *HttpAPI) Downtimed(params martini.Params, r render.Render) {
+	downtimes, err := inst.ReadActiveDowntime()
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, downtimes)
+}
+
+
+// getRequestOwner returns the owner on behalf of whom a request is made: the authenticated user, if any,
+// or else the optional `owner` query parameter
+func (this *HttpAPI) getRequestOwner(req *http.Request) string {
+	if user, _, ok := req.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return req.URL.Query().Get("owner")
+}
+
+
 // MoveUp attempts to move an instance up the topology
-func (this *HttpAPI) MoveUp(params martini.Params, r render.Render) {
+func (this *HttpAPI) MoveUp(params martini.Params, r render.Render, req *http.Request) {
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
 		return
 	}
-	instance, err := inst.MoveUp(&instanceKey)
+	instance, err := inst.MoveUp(&instanceKey, this.getRequestOwner(req))
 	if err != nil {
 		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
 		return
@@ -213,8 +288,27 @@ func (this *HttpAPI) MoveUp(params martini.Params, r render.Render) {
 }
 
 
+// MoveUpSlaves attempts to move up the slaves of an instance, optionally only those satisfying tag selectors
+// (`tag` request param)
+func (this *HttpAPI) MoveUpSlaves(params martini.Params, r render.Render, req *http.Request) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	slaves, err := inst.MoveUpSlaves(&instanceKey, req.URL.Query().Get("tag"), this.getRequestOwner(req))
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(), Details: slaves})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code:OK, Message: fmt.Sprintf("%d slaves of %+v moved up", len(slaves), instanceKey), Details: slaves})
+}
+
+
 // MoveUp attempts to move an instance below its supposed sibling
-func (this *HttpAPI) MoveBelow(params martini.Params, r render.Render) {
+func (this *HttpAPI) MoveBelow(params martini.Params, r render.Render, req *http.Request) {
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
@@ -226,7 +320,7 @@ func (this *HttpAPI) MoveBelow(params martini.Params, r render.Render) {
 		return
 	}
 	
-	instance, err := inst.MoveBelow(&instanceKey, &siblingKey)
+	instance, err := inst.MoveBelow(&instanceKey, &siblingKey, this.getRequestOwner(req))
 	if err != nil {
 		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
 		return
@@ -272,16 +366,152 @@ func (this *HttpAPI) StopSlave(params martini.Params, r render.Render) {
 }
 
 
-// Cluster provides list of instances in given cluster
-func (this *HttpAPI) Cluster(params martini.Params, r render.Render) {
-	instances, err := inst.ReadClusterInstances(params["clusterName"])
+// renderInstances renders a list of instances, optionally filtered by data center (`dc` request param)
+// and optionally grouped by data center (`groupBy=dc` request param)
+func (this *HttpAPI) renderInstances(instances [](*inst.Instance), r render.Render, req *http.Request) {
+	if dataCenter := req.URL.Query().Get("dc"); dataCenter != "" {
+		instances = inst.FilterInstancesByDataCenter(instances, dataCenter)
+	}
+	if req.URL.Query().Get("groupBy") == "dc" {
+		r.JSON(200, inst.GroupInstancesByDataCenter(instances))
+		return
+	}
+	r.JSON(200, instances)
+}
+
+
+// Cluster provides list of instances in given cluster, optionally satisfying tag selectors (`tag` request param)
+func (this *HttpAPI) Cluster(params martini.Params, r render.Render, req *http.Request) {
+	instances, err := inst.ReadClusterInstances(params["clusterName"], req.URL.Query().Get("tag"))
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
 		return
 	}
 
-	r.JSON(200, instances)
+	this.renderInstances(instances, r, req)
+}
+
+
+// ClusterSnapshot provides list of instances in given cluster, as recorded by the latest topology snapshot
+// taken at or before given timestamp (`at` request param, formatted as 'YYYY-MM-DD HH:MM:SS')
+func (this *HttpAPI) ClusterSnapshot(params martini.Params, r render.Render, req *http.Request) {
+	historyTimestamp := req.URL.Query().Get("at")
+	if historyTimestamp == "" {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: "Expected 'at' param (YYYY-MM-DD HH:MM:SS)",})
+		return
+	}
+	instances, err := inst.ReadHistoryClusterInstances(params["clusterName"], historyTimestamp)
+	if err == nil {
+		instances, err = inst.FilterInstancesByTags(instances, req.URL.Query().Get("tag"))
+	}
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	this.renderInstances(instances, r, req)
+}
+
+
+// LagHistory provides the lag samples of given instance within `from` and `to` request params
+// (formatted as 'YYYY-MM-DD HH:MM:SS'; default to last hour)
+func (this *HttpAPI) LagHistory(params martini.Params, r render.Render, req *http.Request) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	samples, err := inst.ReadLagHistory(&instanceKey, req.URL.Query().Get("from"), req.URL.Query().Get("to"))
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, samples)
+}
+
+
+// ClusterLagHistory provides lag of given cluster's slaves, aggregated over time buckets (`bucket` request param,
+// in seconds, default 60), within `from` and `to` request params (see LagHistory)
+func (this *HttpAPI) ClusterLagHistory(params martini.Params, r render.Render, req *http.Request) {
+	bucketSeconds, err := strconv.Atoi(req.URL.Query().Get("bucket"))
+	if err != nil { bucketSeconds = 60 }
+	samples, err := inst.ReadClusterLagHistory(params["clusterName"], req.URL.Query().Get("from"), req.URL.Query().Get("to"), bucketSeconds)
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, samples)
+}
+
+
+// Leader provides the current leader lease
+func (this *HttpAPI) Leader(params martini.Params, r render.Render) {
+	leader, err := process.ReadLeader()
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, leader)
+}
+
+
+// Status provides this node's identity and leadership status
+func (this *HttpAPI) Status(params martini.Params, r render.Render) {
+	status, err := process.ReadNodeStatus()
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, status)
+}
+
+
+// DiscoveryOwnership provides the discovery node in charge of polling each known instance (or of given instance),
+// along with the list of live discovery nodes
+func (this *HttpAPI) DiscoveryOwnership(params martini.Params, r render.Render) {
+	instanceKeys := []inst.InstanceKey{}
+	if params["host"] != "" {
+		instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+		if err != nil {
+			r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+			return
+		}
+		instanceKeys = append(instanceKeys, instanceKey)
+	} else {
+		var err error
+		if instanceKeys, err = inst.ReadAllInstanceKeys(); err != nil {
+			r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+			return
+		}
+	}
+	nodes, err := process.ReadDiscoveryNodes()
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	type instanceOwnership struct {
+		Key		inst.InstanceKey
+		Node	string
+	}
+	ownership := []instanceOwnership{}
+	for _, instanceKey := range instanceKeys {
+		ownership = append(ownership, instanceOwnership{Key: instanceKey, Node: process.GetDiscoveryOwner(instanceKey.DisplayString())})
+	}
+	r.JSON(200, map[string]interface{}{
+		"Nodes": nodes,
+		"Ownership": ownership,
+	})
 }
 
 
@@ -298,20 +528,47 @@ func (this *HttpAPI) Clusters(params martini.Params, r render.Render) {
 }
 
 
-// Search provides list of instances matching given search param via various criteria.
+// ClustersInfo provides list of known clusters along with their aliases
+func (this *HttpAPI) ClustersInfo(params martini.Params, r render.Render) {
+	clustersInfo, err := inst.ReadClustersInfo()
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, clustersInfo)
+}
+
+
+// SetClusterAlias manually sets an alias for given cluster
+func (this *HttpAPI) SetClusterAlias(params martini.Params, r render.Render) {
+	err := inst.SetClusterAlias(params["clusterName"], params["alias"])
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code:OK, Message: fmt.Sprintf("Cluster %s now has alias %s", params["clusterName"], params["alias"]),})
+}
+
+
+// Search provides list of instances matching given search param via various criteria, optionally satisfying
+// tag selectors (`tag` request param)
 func (this *HttpAPI) Search(params martini.Params, r render.Render, req *http.Request) {
 	searchString := params["searchString"]
 	if searchString == "" {
 		searchString = req.URL.Query().Get("s");
 	}
-	instances, err := inst.SearchInstances(searchString)
+	instances, err := inst.SearchInstances(searchString, req.URL.Query().Get("tag"))
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
 		return
 	}
 
-	r.JSON(200, instances)
+	this.renderInstances(instances, r, req)
 }
 
 
@@ -328,18 +585,259 @@ func (this *HttpAPI) Problems(params martini.Params, r render.Render, req *http.
 }
 
 
-// Audit provides listof audit entries by given page number
+// Audit provides a page of audit entries, latest first, optionally filtered by instance (host:port), cluster,
+// type, owner and time range (since, until). The next page is read by passing the last AuditId as `before`.
+// Unfiltered audit is also provided by page number.
 func (this *HttpAPI) Audit(params martini.Params, r render.Render, req *http.Request) {
+	if params["page"] != "" {
+		page, err := strconv.Atoi(params["page"])
+		if err != nil || page < 0 { page = 0 }
+		audits, err := inst.ReadRecentAudit(page)
+		if err != nil {
+			r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+			return
+		}
+		r.JSON(200, audits)
+		return
+	}
+	query := req.URL.Query()
+	filter := &inst.AuditFilter{
+		ClusterName:	query.Get("cluster"),
+		AuditType:		query.Get("type"),
+		Owner:			query.Get("owner"),
+		Since:			query.Get("since"),
+		Until:			query.Get("until"),
+	}
+	if instance := query.Get("instance"); instance != "" {
+		instanceKey, err := inst.ParseInstanceKey(instance)
+		if err != nil {
+			r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+			return
+		}
+		filter.InstanceKey = *instanceKey
+	}
+	if before := query.Get("before"); before != "" {
+		beforeAuditId, err := strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("Invalid before: %s", before),})
+			return
+		}
+		filter.BeforeAuditId = beforeAuditId
+	}
+	audits, err := inst.ReadAudit(filter)
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, audits)
+}
+
+
+// HostnameAliases provides list of learned hostname aliases
+func (this *HttpAPI) HostnameAliases(params martini.Params, r render.Render) {
+	hostnameAliases, err := inst.ReadHostnameAliases()
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, hostnameAliases)
+}
+
+
+// Tag attaches a name=value tag to an instance
+func (this *HttpAPI) Tag(params martini.Params, r render.Render) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	tag, err := inst.ParseTag(params["tag"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	if err := inst.PutInstanceTag(&instanceKey, tag); err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code:OK, Message: fmt.Sprintf("%+v tagged with %s", instanceKey, tag.String()),})
+}
+
+
+// Untag removes a tag, by name, from an instance
+func (this *HttpAPI) Untag(params martini.Params, r render.Render) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	if err := inst.UntagInstance(&instanceKey, params["tagName"]); err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code:OK, Message: fmt.Sprintf("%+v untagged: %s", instanceKey, params["tagName"]),})
+}
+
+
+// Tags lists the tags of an instance
+func (this *HttpAPI) Tags(params martini.Params, r render.Render) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	tags, err := inst.ReadInstanceTags(&instanceKey)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, tags)
+}
+
+
+// Tagged lists keys of instances satisfying given tag selectors (`tag` request param)
+func (this *HttpAPI) Tagged(params martini.Params, r render.Render, req *http.Request) {
+	instanceKeys, err := inst.ReadInstanceKeysByTags(req.URL.Query().Get("tag"))
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, &instanceKeys)
+}
+
+
+// RegisterCandidate registers a promotion rule (prefer|neutral|prefer_not|must_not) for given instance
+func (this *HttpAPI) RegisterCandidate(params martini.Params, r render.Render) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	promotionRule, err := inst.ParseCandidatePromotionRule(params["promotionRule"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	if err := inst.RegisterCandidateInstance(&instanceKey, promotionRule); err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code:OK, Message: fmt.Sprintf("Registered candidate: %+v, %s", instanceKey, promotionRule),})
+}
+
+
+// Candidates lists registered, non-expired promotion rules
+func (this *HttpAPI) Candidates(params martini.Params, r render.Render) {
+	candidates, err := inst.ReadCandidateDatabaseInstances()
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, candidates)
+}
+
+
+// CandidateSlave returns the slave best suited to be promoted in place of given master
+func (this *HttpAPI) CandidateSlave(params martini.Params, r render.Render) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+	candidate, err := inst.GetCandidateSlave(&instanceKey)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+		return
+	}
+
+	r.JSON(200, candidate)
+}
+
+
+// DiscoverySeeds provides list of discovery seeds (as configured or listed in seeds file), including removed ones
+func (this *HttpAPI) DiscoverySeeds(params martini.Params, r render.Render) {
+	seeds, err := inst.ReadDiscoverySeeds()
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+
+	r.JSON(200, seeds)
+}
+
+
+// DiscoveryFilterHits provides list of instances filtered out of discovery, with hit counts
+func (this *HttpAPI) DiscoveryFilterHits(params martini.Params, r render.Render) {
+	r.JSON(200, inst.ReadDiscoveryFilterHits())
+}
+
+
+// DiscoveryTimings provides discovery timing percentiles along with the slowest instances (limited by ?limit=, default 10),
+// or, given an instance, its recent discovery timings. Timings are as persisted by all discovering nodes.
+func (this *HttpAPI) DiscoveryTimings(params martini.Params, r render.Render, req *http.Request) {
+	if params["host"] != "" {
+		instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+		if err != nil {
+			r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+			return
+		}
+		timings, err := inst.ReadStoredInstanceDiscoveryTimings(&instanceKey)
+		if err != nil {
+			r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+			return
+		}
+		r.JSON(200, timings)
+		return
+	}
+	limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+	if err != nil { limit = 10 }
+
+	timings, err := inst.ReadStoredDiscoveryTimings()
+	if err != nil {
+		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
+		return
+	}
+	r.JSON(200, map[string]interface{}{
+		"Percentiles": timings.Percentiles(),
+		"SlowestInstances": timings.SlowestInstances(limit),
+	})
+}
+
+
+// Events provides list of instance change events by given page number, optionally for a given instance
+func (this *HttpAPI) Events(params martini.Params, r render.Render, req *http.Request) {
 	page, err := strconv.Atoi(params["page"])
 	if err != nil || page < 0 { page = 0 }
-	audits, err := inst.ReadRecentAudit(page)
+
+	var events []inst.InstanceEvent
+	if params["host"] != "" {
+		instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+		if err != nil {
+			r.JSON(200, &APIResponse{Code:ERROR, Message: err.Error(),})
+			return
+		}
+		events, err = inst.ReadInstanceEvents(&instanceKey, page)
+	} else {
+		events, err = inst.ReadRecentInstanceEvents(page)
+	}
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code:ERROR, Message: fmt.Sprintf("%+v", err),})
 		return
 	}
 
-	r.JSON(200, audits)
+	r.JSON(200, events)
 }
 
 
@@ -350,18 +848,48 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	m.Get("/api/refresh/:host/:port", this.Refresh) 
 	m.Get("/api/forget/:host/:port", this.Forget) 
 	m.Get("/api/move-up/:host/:port", this.MoveUp) 
+	m.Get("/api/move-up-slaves/:host/:port", this.MoveUpSlaves) 
 	m.Get("/api/move-below/:host/:port/:siblingHost/:siblingPort", this.MoveBelow) 
 	m.Get("/api/begin-maintenance/:host/:port/:owner/:reason", this.BeginMaintenance) 
+	m.Get("/api/begin-maintenance/:host/:port/:owner/:reason/:duration", this.BeginMaintenance) 
 	m.Get("/api/end-maintenance/:host/:port", this.EndMaintenanceByInstanceKey) 
 	m.Get("/api/end-maintenance/:maintenanceKey", this.EndMaintenance)	
 	m.Get("/api/start-slave/:host/:port", this.StartSlave) 
 	m.Get("/api/stop-slave/:host/:port", this.StopSlave) 
 	m.Get("/api/maintenance", this.Maintenance) 
+	m.Get("/api/begin-downtime/:host/:port/:owner/:reason/:duration", this.BeginDowntime) 
+	m.Get("/api/end-downtime/:host/:port", this.EndDowntime) 
+	m.Get("/api/downtimed", this.Downtimed) 
 	m.Get("/api/cluster/:clusterName", this.Cluster) 
+	m.Get("/api/cluster-snapshot/:clusterName", this.ClusterSnapshot) 
 	m.Get("/api/clusters", this.Clusters) 
+	m.Get("/api/leader", this.Leader) 
+	m.Get("/api/status", this.Status) 
+	m.Get("/api/discovery-ownership", this.DiscoveryOwnership) 
+	m.Get("/api/discovery-ownership/:host/:port", this.DiscoveryOwnership) 
+	m.Get("/api/lag-history/:host/:port", this.LagHistory) 
+	m.Get("/api/cluster-lag-history/:clusterName", this.ClusterLagHistory) 
+	m.Get("/api/clusters-info", this.ClustersInfo) 
+	m.Get("/api/set-cluster-alias/:clusterName/:alias", this.SetClusterAlias) 
 	m.Get("/api/search/:searchString", this.Search) 
 	m.Get("/api/search", this.Search) 
 	m.Get("/api/problems", this.Problems) 
 	m.Get("/api/audit", this.Audit) 
 	m.Get("/api/audit/:page", this.Audit) 
+	m.Get("/api/events", this.Events) 
+	m.Get("/api/discovery-timings", this.DiscoveryTimings) 
+	m.Get("/api/discovery-timings/:host/:port", this.DiscoveryTimings) 
+	m.Get("/api/events/:page", this.Events) 
+	m.Get("/api/instance-events/:host/:port", this.Events) 
+	m.Get("/api/instance-events/:host/:port/:page", this.Events) 
+	m.Get("/api/hostname-aliases", this.HostnameAliases) 
+	m.Get("/api/discovery-seeds", this.DiscoverySeeds) 
+	m.Get("/api/discovery-filter-hits", this.DiscoveryFilterHits) 
+	m.Get("/api/tag/:host/:port/:tag", this.Tag) 
+	m.Get("/api/untag/:host/:port/:tagName", this.Untag) 
+	m.Get("/api/tags/:host/:port", this.Tags) 
+	m.Get("/api/tagged", this.Tagged) 
+	m.Get("/api/register-candidate/:host/:port/:promotionRule", this.RegisterCandidate) 
+	m.Get("/api/candidates", this.Candidates) 
+	m.Get("/api/candidate-slave/:host/:port", this.CandidateSlave) 
 }
@@ -77,13 +77,23 @@ func (this *HttpWeb) Discover(params martini.Params, r render.Render) {
 
 
 func (this *HttpWeb) Audit(params martini.Params, r render.Render) {
-	page, err := strconv.Atoi(params["page"])
-	if err != nil { page = 0 }
+	instance := ""
+	if params["host"] != "" {
+		instance = fmt.Sprintf("%s:%s", params["host"], params["port"])
+	}
+	// A page number is translated to the cursor at which that page begins
+	before := ""
+	if page, err := strconv.Atoi(params["page"]); err == nil && page > 0 {
+		if audits, err := inst.ReadRecentAudit(page - 1); err == nil && len(audits) > 0 {
+			before = fmt.Sprintf("%d", audits[len(audits) - 1].AuditId)
+		}
+	}
 
 	r.HTML(200, "templates/audit", map[string]interface{}{
 		"title": "audit", 
 		"autoshow_problems": false,
-		"page": page,
+		"instance": instance,
+		"before": before,
 		})
 }
 
@@ -130,4 +140,5 @@ func (this *HttpWeb) RegisterRequests(m *martini.ClassicMartini) {
 	m.Get("/web/discover", this.Discover) 
 	m.Get("/web/audit", this.Audit) 
 	m.Get("/web/audit/:page", this.Audit) 
+	m.Get("/web/audit/instance/:host/:port", this.Audit) 
 }
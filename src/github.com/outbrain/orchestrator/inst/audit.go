@@ -26,5 +26,19 @@ type Audit struct {
 	AuditTimestamp		string
 	AuditType			string
 	AuditInstanceKey	InstanceKey
+	Owner				string
 	Message				string
 }
+
+// AuditFilter narrows down audit queries. Empty fields match all.
+// ClusterName (or alias) matches entries of instances currently in the cluster; the cluster an instance
+// belonged to at the time of the audit is not recorded.
+type AuditFilter struct {
+	InstanceKey		InstanceKey
+	ClusterName		string
+	AuditType		string
+	Owner			string
+	Since			string	// Inclusive, 'YYYY-MM-DD HH:MM:SS'
+	Until			string	// Exclusive, 'YYYY-MM-DD HH:MM:SS'
+	BeforeAuditId	int64	// Paging cursor: only entries older than this audit id. 0 means from the latest
+}
@@ -18,6 +18,11 @@ package inst
 
 import (
 	"fmt"
+	"os"
+	"path"
+	"strings"
+	"compress/gzip"
+	"encoding/json"
 	"github.com/outbrain/sqlutils"
 	"github.com/outbrain/orchestrator/db"
 	"github.com/outbrain/log"
@@ -27,6 +32,11 @@ import (
 
 // AuditOperation creates and writes a new audit entry by given params
 func AuditOperation(auditType string, instanceKey *InstanceKey, message string) error {
+	return AuditOwnedOperation(auditType, instanceKey, "", message)
+}
+
+// AuditOwnedOperation creates and writes a new audit entry on behalf of given owner
+func AuditOwnedOperation(auditType string, instanceKey *InstanceKey, owner string, message string) error {
 	db,	err	:=	db.OpenOrchestrator()
 	if err != nil {return log.Errore(err)}
 	
@@ -37,14 +47,15 @@ func AuditOperation(auditType string, instanceKey *InstanceKey, message string)
 	_, err = sqlutils.Exec(db, `
 			insert 
 				into audit (
-					audit_timestamp, audit_type, hostname, port, message
+					audit_timestamp, audit_type, hostname, port, owner, message
 				) VALUES (
-					NOW(), ?, ?, ?, ?
+					NOW(), ?, ?, ?, ?, ?
 				)
 			`,
 			auditType,
 			instanceKey.Hostname, 
 		 	instanceKey.Port,
+		 	owner,
 		 	message,
 		 )
 	if err != nil {return log.Errore(err)}
@@ -52,24 +63,70 @@ func AuditOperation(auditType string, instanceKey *InstanceKey, message string)
 	return err
 }
 
-// ReadRecentAudit returns a list of audit entries order chronologically descending, using page number.
-func ReadRecentAudit(page int) ([]Audit, error) {
-	res := []Audit{}
-	query := fmt.Sprintf(`
+// whereCondition returns the SQL condition and arguments matching this filter. Empty fields match all.
+func (this *AuditFilter) whereCondition() (string, []interface{}) {
+	conditions := []string{"1=1"}
+	args := []interface{}{}
+	if this.InstanceKey.IsValid() {
+		conditions = append(conditions, "hostname = ? and port = ?")
+		args = append(args, this.InstanceKey.Hostname, this.InstanceKey.Port)
+	}
+	if this.ClusterName != "" {
+		conditions = append(conditions, "(hostname, port) in (select hostname, port from database_instance where cluster_name = ?)")
+		args = append(args, this.ClusterName)
+	}
+	if this.AuditType != "" {
+		conditions = append(conditions, "audit_type = ?")
+		args = append(args, this.AuditType)
+	}
+	if this.Owner != "" {
+		conditions = append(conditions, "owner = ?")
+		args = append(args, this.Owner)
+	}
+	if this.Since != "" {
+		conditions = append(conditions, "audit_timestamp >= ?")
+		args = append(args, this.Since)
+	}
+	if this.Until != "" {
+		conditions = append(conditions, "audit_timestamp < ?")
+		args = append(args, this.Until)
+	}
+	if this.BeforeAuditId > 0 {
+		conditions = append(conditions, "audit_id < ?")
+		args = append(args, this.BeforeAuditId)
+	}
+	return strings.Join(conditions, " and "), args
+}
+
+// readAudit reads audit entries matching given filter, passing each to given function. A positive limit
+// reads at most that many entries, skipping the first `offset` ones.
+func readAudit(filter *AuditFilter, orderBy string, limit int, offset int, onAudit func(Audit) error) error {
+	if filter.ClusterName != "" {
+		clusterName, err := ReadClusterNameByAlias(filter.ClusterName)
+		if err != nil {return log.Errore(err)}
+		resolvedFilter := *filter
+		resolvedFilter.ClusterName = clusterName
+		filter = &resolvedFilter
+	}
+	whereCondition, args := filter.whereCondition()
+	query := `
 		select 
 			audit_id,
 			audit_timestamp,
 			audit_type,
 			hostname,
 			port,
+			owner,
 			message
 		from 
 			audit
+		where
+			` + whereCondition + `
 		order by
-			audit_timestamp desc
-		limit %d
-		offset %d
-		`, config.Config.AuditPageSize, page * config.Config.AuditPageSize)
+			` + orderBy
+	if limit > 0 {
+		query = query + fmt.Sprintf(" limit %d offset %d", limit, offset)
+	}
 	db,	err	:=	db.OpenOrchestrator()
     if err != nil {goto Cleanup}
     
@@ -80,16 +137,127 @@ func ReadRecentAudit(page int) ([]Audit, error) {
     	audit.AuditType = m.GetString("audit_type")
     	audit.AuditInstanceKey.Hostname = m.GetString("hostname")
     	audit.AuditInstanceKey.Port = m.GetInt("port")
+    	audit.Owner = m.GetString("owner")
     	audit.Message = m.GetString("message") 
 
-    	res = append(res, audit)
-    	return err       	
-   	})
+    	return onAudit(audit)
+   	}, args...)
 	Cleanup:
 
 	if err	!=	nil	{
 		log.Errore(err)
 	}
+	return err
+}
+
+// ReadAudit returns a page of audit entries matching given filter, latest first. The next page is read by
+// setting the filter's BeforeAuditId to the AuditId of the last entry returned.
+func ReadAudit(filter *AuditFilter) ([]Audit, error) {
+	res := []Audit{}
+	err := readAudit(filter, "audit_id desc", config.Config.AuditPageSize, 0, func(audit Audit) error {
+		res = append(res, audit)
+		return nil
+	})
+	return res, err
+}
+
+// ReadRecentAudit returns a list of audit entries order chronologically descending, using page number.
+func ReadRecentAudit(page int) ([]Audit, error) {
+	res := []Audit{}
+	err := readAudit(&AuditFilter{}, "audit_id desc", config.Config.AuditPageSize, page * config.Config.AuditPageSize, func(audit Audit) error {
+		res = append(res, audit)
+		return nil
+	})
 	return res, err
+}
+
+// readAuditRange reads audit entries in given time range, oldest first, passing each to given function.
+// An empty `since` means from the beginning; an empty `until` means now. `until` is exclusive.
+func readAuditRange(since string, until string, onAudit func(Audit) error) error {
+	return readAudit(&AuditFilter{Since: since, Until: until}, "audit_id asc", 0, 0, onAudit)
+}
 
+// ExportAudit writes audit entries in given time range (see readAuditRange) into given file, as gzip'd JSON lines.
+// It returns the number of exported entries. On error the file is removed, such that no partial export is left behind.
+func ExportAudit(fileName string, since string, until string) (int, error) {
+	file, err := os.Create(fileName)
+	if err != nil {return 0, log.Errore(err)}
+
+	gzipWriter := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gzipWriter)
+	count := 0
+	err = readAuditRange(since, until, func(audit Audit) error {
+		count++
+		return encoder.Encode(audit)
+	})
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fileName)
+		return count, log.Errore(err)
+	}
+
+	return count, nil
+}
+
+// auditPurgeBatchSize is the number of audit entries removed per delete statement
+const auditPurgeBatchSize = 1000
+
+// PurgeAudit removes audit entries older than AuditPurgeDays. When AuditArchiveDirectory is set, these
+// entries are first exported into an archive file there; a failed export leaves the entries in place.
+func PurgeAudit() error {
+	if config.Config.AuditPurgeDays == 0 {
+		return nil
+	}
+	// Export and purge use the same, fixed, boundary
+	purgeTimestamp := ""
+	query := `select NOW() - interval ? day as purge_timestamp`
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		purgeTimestamp = m.GetString("purge_timestamp")
+		return nil
+	}, config.Config.AuditPurgeDays)
+	if err != nil {return log.Errore(err)}
+
+	if config.Config.AuditArchiveDirectory != "" {
+		fileName := path.Join(config.Config.AuditArchiveDirectory,
+			fmt.Sprintf("audit-%s.json.gz", strings.NewReplacer("-", "", ":", "", " ", "-").Replace(purgeTimestamp)))
+		count, err := ExportAudit(fileName, "", purgeTimestamp)
+		if err != nil {return log.Errore(err)}
+		if count == 0 {
+			os.Remove(fileName)
+		} else {
+			log.Infof("Archived %d audit entries into %s", count, fileName)
+		}
+	}
+	// Purge in small batches so as not to hold long locks on the audit table
+	query = `
+			delete
+				from audit
+			where
+				audit_timestamp < ?
+			limit ?
+			`
+	if config.Config.IsSQLite() {
+		// SQLite has no delete ... limit
+		query = `
+			delete
+				from audit
+			where
+				audit_id in (select audit_id from audit where audit_timestamp < ? limit ?)
+			`
+	}
+	for {
+		res, err := sqlutils.Exec(db, query, purgeTimestamp, auditPurgeBatchSize)
+		if err != nil {return log.Errore(err)}
+		if affected, _ := res.RowsAffected(); affected < auditPurgeBatchSize {
+			return nil
+		}
+	}
 }
@@ -0,0 +1,96 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"errors"
+	"sort"
+)
+
+// CandidatePromotionRule describes whether an instance may, or should, be promoted to master
+type CandidatePromotionRule string
+
+const (
+	PreferPromoteRule		CandidatePromotionRule = "prefer"
+	NeutralPromoteRule		CandidatePromotionRule = "neutral"
+	PreferNotPromoteRule	CandidatePromotionRule = "prefer_not"
+	MustNotPromoteRule		CandidatePromotionRule = "must_not"
+)
+
+// ParseCandidatePromotionRule returns the promotion rule by its name
+func ParseCandidatePromotionRule(ruleName string) (CandidatePromotionRule, error) {
+	switch CandidatePromotionRule(ruleName) {
+		case PreferPromoteRule, NeutralPromoteRule, PreferNotPromoteRule, MustNotPromoteRule:
+			return CandidatePromotionRule(ruleName), nil
+	}
+	return NeutralPromoteRule, errors.New(fmt.Sprintf("Invalid promotion rule: %s. Expected prefer|neutral|prefer_not|must_not", ruleName))
+}
+
+// order returns a sort order for this rule; lower is more desired
+func (this CandidatePromotionRule) order() int {
+	switch this {
+		case PreferPromoteRule: return 0
+		case PreferNotPromoteRule: return 2
+		case MustNotPromoteRule: return 3
+	}
+	return 1
+}
+
+// CandidateDatabaseInstance is a registered promotion rule for an instance
+type CandidateDatabaseInstance struct {
+	Key				InstanceKey
+	PromotionRule	CandidatePromotionRule
+	LastSuggested	string
+}
+
+// promotionCandidates sorts instances by promotion rule, then by replication progress (most advanced first)
+type promotionCandidates struct {
+	instances		[](*Instance)
+	promotionRules	map[InstanceKey]CandidatePromotionRule
+}
+
+func (this *promotionCandidates) Len() int {
+	return len(this.instances)
+}
+
+func (this *promotionCandidates) Swap(i, j int) {
+	this.instances[i], this.instances[j] = this.instances[j], this.instances[i]
+}
+
+func (this *promotionCandidates) Less(i, j int) bool {
+	iOrder := this.promotionRules[this.instances[i].Key].order()
+	jOrder := this.promotionRules[this.instances[j].Key].order()
+	if iOrder != jOrder {
+		return iOrder < jOrder
+	}
+	return this.instances[j].ExecBinlogCoordinates.SmallerThan(&this.instances[i].ExecBinlogCoordinates)
+}
+
+// SortPromotionCandidates sorts given slaves in order of promotion preference, and removes those
+// which must not be promoted. Slaves with no registered rule are considered neutral.
+func SortPromotionCandidates(slaves [](*Instance), promotionRules map[InstanceKey]CandidatePromotionRule) [](*Instance) {
+	candidates := [](*Instance){}
+	for _, slave := range slaves {
+		if rule, found := promotionRules[slave.Key]; found && rule == MustNotPromoteRule {
+			continue
+		}
+		candidates = append(candidates, slave)
+	}
+	sort.Sort(&promotionCandidates{instances: candidates, promotionRules: promotionRules})
+	return candidates
+}
@@ -0,0 +1,160 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"errors"
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// RegisterCandidateInstance registers (or re-registers, refreshing expiry) a promotion rule for given instance
+func RegisterCandidateInstance(instanceKey *InstanceKey, promotionRule CandidatePromotionRule) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			replace
+				into candidate_database_instance (
+					hostname, port, promotion_rule, last_suggested
+				) VALUES (
+					?, ?, ?, NOW()
+				)
+			`,
+			instanceKey.Hostname,
+		 	instanceKey.Port,
+		 	string(promotionRule),
+		 )
+	if err != nil {return log.Errore(err)}
+
+	AuditOperation("register-candidate", instanceKey, string(promotionRule))
+	return nil
+}
+
+// ExpireCandidateInstances removes promotion rules which have not been re-registered for
+// CandidateInstanceExpireMinutes
+func ExpireCandidateInstances() error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			delete
+				from candidate_database_instance
+			where
+				last_suggested < NOW() - interval ? minute
+			`,
+			config.Config.CandidateInstanceExpireMinutes,
+		 )
+	return err
+}
+
+// ReadCandidateDatabaseInstances returns all non-expired promotion rules
+func ReadCandidateDatabaseInstances() ([]CandidateDatabaseInstance, error) {
+	res := []CandidateDatabaseInstance{}
+	query := `
+		select
+			hostname,
+			port,
+			promotion_rule,
+			last_suggested
+		from
+			candidate_database_instance
+		where
+			last_suggested >= NOW() - interval ? minute
+		order by
+			hostname, port
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	candidate := CandidateDatabaseInstance{}
+    	candidate.Key.Hostname = m.GetString("hostname")
+    	candidate.Key.Port = m.GetInt("port")
+    	candidate.PromotionRule = CandidatePromotionRule(m.GetString("promotion_rule"))
+    	candidate.LastSuggested = m.GetString("last_suggested")
+
+    	res = append(res, candidate)
+    	return nil
+   	}, config.Config.CandidateInstanceExpireMinutes)
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// ReadPromotionRules maps instances onto their non-expired promotion rules
+func ReadPromotionRules() (map[InstanceKey]CandidatePromotionRule, error) {
+	promotionRules := make(map[InstanceKey]CandidatePromotionRule)
+	candidates, err := ReadCandidateDatabaseInstances()
+	for _, candidate := range candidates {
+		promotionRules[candidate.Key] = candidate.PromotionRule
+	}
+	return promotionRules, err
+}
+
+// GetCandidateSlave chooses the best slave of given master to be promoted in its place, consulting
+// registered promotion rules. Only slaves which all other eligible slaves are able to replicate from are considered.
+// Downtimed slaves are skipped; a downtimed master has no candidate.
+func GetCandidateSlave(masterKey *InstanceKey) (*Instance, error) {
+	slaves, err := ReadSlaveInstances(masterKey)
+	if err != nil {return nil, err}
+	promotionRules, err := ReadPromotionRules()
+	if err != nil {return nil, err}
+	downtimedKeys, err := ReadDowntimedInstanceKeys()
+	if err != nil {return nil, err}
+	if downtimedKeys[*masterKey] {
+		// A downtimed master is not subject to recovery either
+		return nil, errors.New(fmt.Sprintf("Master is downtimed: %+v", *masterKey))
+	}
+
+	eligibleSlaves := [](*Instance){}
+	for _, slave := range slaves {
+		if downtimedKeys[slave.Key] {
+			// Downtimed instances are not subject to recovery
+			continue
+		}
+		if slave.LogBinEnabled && slave.LogSlaveUpdatesEnabled && slave.IsLastCheckValid {
+			eligibleSlaves = append(eligibleSlaves, slave)
+		}
+	}
+	candidates := SortPromotionCandidates(eligibleSlaves, promotionRules)
+	for _, candidate := range candidates {
+		if canBeReplicatedBySiblings(candidate, eligibleSlaves) {
+			return candidate, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("No promotion candidate found for %+v", *masterKey))
+}
+
+// canBeReplicatedBySiblings checks whether all given siblings are able to replicate from given candidate
+func canBeReplicatedBySiblings(candidate *Instance, siblings [](*Instance)) bool {
+	for _, sibling := range siblings {
+		if sibling.Key.Equals(&candidate.Key) {
+			continue
+		}
+		if canReplicate, _ := sibling.CanReplicateFrom(candidate); !canReplicate {
+			return false
+		}
+	}
+	return true
+}
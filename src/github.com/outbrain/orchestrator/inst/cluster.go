@@ -0,0 +1,65 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+// ClusterInfo makes for a cluster status/info summary
+type ClusterInfo struct {
+	ClusterName		string
+	ClusterAlias	string
+}
+
+// ComputeClusterNames deduces the cluster name of each instance by walking up the given instance => master edges.
+// The cluster name is that of the topology's root: an instance with no master, or whose master is unknown
+// (an orphaned subtree is thus a cluster of its own). Where the walk runs into a cycle (e.g. co-masters),
+// the smallest member of the cycle names the cluster, such that the result does not depend on walk order.
+func ComputeClusterNames(masters map[InstanceKey]InstanceKey) map[InstanceKey]string {
+	clusterNames := make(map[InstanceKey]string)
+	for instanceKey := range masters {
+		path := []InstanceKey{}
+		pathIndexes := make(map[InstanceKey]int)
+		current := instanceKey
+		clusterName := ""
+		for {
+			if knownClusterName, found := clusterNames[current]; found {
+				clusterName = knownClusterName
+				break
+			}
+			if index, found := pathIndexes[current]; found {
+				clusterName = current.DisplayString()
+				for _, cycleKey := range path[index:] {
+					if cycleKey.DisplayString() < clusterName {
+						clusterName = cycleKey.DisplayString()
+					}
+				}
+				break
+			}
+			pathIndexes[current] = len(path)
+			path = append(path, current)
+
+			master := masters[current]
+			if _, known := masters[master]; !known || !master.IsValid() {
+				clusterName = current.DisplayString()
+				break
+			}
+			current = master
+		}
+		for _, pathKey := range path {
+			clusterNames[pathKey] = clusterName
+		}
+	}
+	return clusterNames
+}
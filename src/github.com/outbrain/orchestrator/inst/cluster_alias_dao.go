@@ -0,0 +1,145 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// cachedClusterAlias is a cached lookup of a cluster's alias (empty when it has none)
+type cachedClusterAlias struct {
+	alias		string
+	readTime	time.Time
+}
+
+// cachedClusterAliases caches cluster name => alias lookups, which are made on each instance poll.
+// An entry is trusted for InstancePollSeconds.
+var cachedClusterAliases map[string]cachedClusterAlias = make(map[string]cachedClusterAlias)
+var cachedClusterAliasesMutex sync.Mutex
+
+// WriteClusterAlias will write (and override) a single cluster name mapping. An alias maps onto a single
+// cluster: setting an existing alias to a new cluster name (e.g. following master failover) moves the alias.
+func WriteClusterAlias(clusterName string, alias string) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			replace
+				into cluster_alias (
+					cluster_name, alias, last_registered
+				) VALUES (
+					?, ?, NOW()
+				)
+			`,
+			clusterName,
+			alias,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	// The alias may have moved from another cluster
+	cachedClusterAliasesMutex.Lock()
+	cachedClusterAliases = make(map[string]cachedClusterAlias)
+	cachedClusterAliasesMutex.Unlock()
+	return nil
+}
+
+// SetClusterAlias manually sets an alias for given cluster, and audits the operation
+func SetClusterAlias(clusterName string, alias string) error {
+	if err := WriteClusterAlias(clusterName, alias); err != nil {
+		return err
+	}
+	AuditOperation("set-cluster-alias", nil, clusterName + " => " + alias)
+	return nil
+}
+
+// ReadClusterNameByAlias returns the cluster name associated with given alias. If no such alias is known,
+// the input is assumed to be a cluster name and is returned as is.
+func ReadClusterNameByAlias(alias string) (string, error) {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return alias, log.Errore(err)}
+
+	var clusterName string
+	err = db.QueryRow(`
+		select
+			cluster_name
+		from
+			cluster_alias
+		where
+			alias = ?`,
+		alias).Scan(
+			&clusterName,
+		)
+	if err == sql.ErrNoRows {return alias, nil}
+	if err != nil {return alias, log.Errore(err)}
+	return clusterName, nil
+}
+
+// readCachedClusterAlias returns the alias for given cluster name (see ReadClusterAlias), as cached or
+// as freshly read
+func readCachedClusterAlias(clusterName string) string {
+	cachedClusterAliasesMutex.Lock()
+	cached, found := cachedClusterAliases[clusterName]
+	cachedClusterAliasesMutex.Unlock()
+	if found && time.Since(cached.readTime) < time.Duration(config.Config.InstancePollSeconds) * time.Second {
+		return cached.alias
+	}
+
+	alias, err := ReadClusterAlias(clusterName)
+	if err != nil {
+		return alias
+	}
+	cachedClusterAliasesMutex.Lock()
+	cachedClusterAliases[clusterName] = cachedClusterAlias{alias: alias, readTime: time.Now()}
+	cachedClusterAliasesMutex.Unlock()
+	return alias
+}
+
+// ReadClusterConfiguration returns the effective lag settings of given cluster, taking its alias into account
+func ReadClusterConfiguration(clusterName string) *config.ClusterConfiguration {
+	if len(config.Config.ClusterConfigurations) == 0 {
+		// No overrides; the alias makes no difference
+		return config.Config.GetClusterConfiguration(clusterName, "")
+	}
+	return config.Config.GetClusterConfiguration(clusterName, readCachedClusterAlias(clusterName))
+}
+
+// ReadClusterAlias returns the alias for given cluster name, or an empty string if it has none
+func ReadClusterAlias(clusterName string) (string, error) {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return "", log.Errore(err)}
+
+	var alias string
+	err = db.QueryRow(`
+		select
+			alias
+		from
+			cluster_alias
+		where
+			cluster_name = ?`,
+		clusterName).Scan(
+			&alias,
+		)
+	if err == sql.ErrNoRows {return "", nil}
+	if err != nil {return "", log.Errore(err)}
+	return alias, nil
+}
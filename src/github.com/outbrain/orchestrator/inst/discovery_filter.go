@@ -0,0 +1,102 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"regexp"
+	"sync"
+	"time"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+const (
+	DiscoveryFilterHostname = "hostname"
+	DiscoveryFilterMasterHostname = "master-hostname"
+)
+
+// DiscoveryFilterHit counts the times an instance was filtered out of discovery
+type DiscoveryFilterHit struct {
+	Key					InstanceKey
+	FilterType			string
+	Filter				string
+	Count				int64
+	LastHitTimestamp	string
+}
+
+// discoveryFilterHits maps filtered instances to their hit count
+var discoveryFilterHits map[InstanceKey]*DiscoveryFilterHit = make(map[InstanceKey]*DiscoveryFilterHit)
+var discoveryFilterHitsMutex sync.Mutex
+
+// matchHostnameFilters returns the first of given compiled filters matching given hostname, if any
+func matchHostnameFilters(hostname string, filters []*regexp.Regexp) (string, bool) {
+	for _, filter := range filters {
+		if filter.MatchString(hostname) {
+			return filter.String(), true
+		}
+	}
+	return "", false
+}
+
+// countDiscoveryFilterHit accounts for a single filtered instance
+func countDiscoveryFilterHit(instanceKey *InstanceKey, filterType string, filter string) {
+	discoveryFilterHitsMutex.Lock()
+	defer discoveryFilterHitsMutex.Unlock()
+
+	hit, found := discoveryFilterHits[*instanceKey]
+	if !found {
+		hit = &DiscoveryFilterHit{Key: *instanceKey}
+		discoveryFilterHits[*instanceKey] = hit
+	}
+	hit.FilterType = filterType
+	hit.Filter = filter
+	hit.Count++
+	hit.LastHitTimestamp = time.Now().Format("2006-01-02 15:04:05")
+	log.Debugf("Instance %+v filtered out of discovery by %s filter: %s", *instanceKey, filterType, filter)
+}
+
+// IsDiscoveryIgnoredInstance returns true when given instance's hostname matches any of the
+// DiscoveryIgnoreHostnameFilters. Such a hit is counted.
+func IsDiscoveryIgnoredInstance(instanceKey *InstanceKey) bool {
+	filter, matched := matchHostnameFilters(instanceKey.Hostname, config.Config.DiscoveryIgnoreHostnameRegexps())
+	if matched {
+		countDiscoveryFilterHit(instanceKey, DiscoveryFilterHostname, filter)
+	}
+	return matched
+}
+
+// IsDiscoveryIgnoredMaster returns true when the hostname of given instance's master matches any of the
+// DiscoveryIgnoreMasterHostnameFilters. Such a hit is counted.
+func IsDiscoveryIgnoredMaster(instanceKey *InstanceKey, masterKey *InstanceKey) bool {
+	filter, matched := matchHostnameFilters(masterKey.Hostname, config.Config.DiscoveryIgnoreMasterHostnameRegexps())
+	if matched {
+		countDiscoveryFilterHit(instanceKey, DiscoveryFilterMasterHostname, filter)
+	}
+	return matched
+}
+
+// ReadDiscoveryFilterHits returns the instances filtered out of discovery since startup, along with hit count
+func ReadDiscoveryFilterHits() []DiscoveryFilterHit {
+	discoveryFilterHitsMutex.Lock()
+	defer discoveryFilterHitsMutex.Unlock()
+
+	res := []DiscoveryFilterHit{}
+	for _, hit := range discoveryFilterHits {
+		res = append(res, *hit)
+	}
+	return res
+}
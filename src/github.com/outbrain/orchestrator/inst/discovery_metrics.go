@@ -0,0 +1,241 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+	"github.com/outbrain/orchestrator/config"
+)
+
+type DiscoveryPhase string
+
+const (
+	ConnectPhase			DiscoveryPhase = "connect"
+	VariablesPhase			DiscoveryPhase = "variables"
+	SlaveStatusPhase		DiscoveryPhase = "slave-status"
+	MasterStatusPhase		DiscoveryPhase = "master-status"
+	SlaveEnumerationPhase	DiscoveryPhase = "slave-enumeration"
+	LagQueryPhase			DiscoveryPhase = "lag-query"
+	BackendWritePhase		DiscoveryPhase = "backend-write"
+	TotalPhase				DiscoveryPhase = "total"
+)
+
+// DiscoveryPhases lists the timed phases of ReadTopologyInstance, in order of execution
+var DiscoveryPhases = []DiscoveryPhase{ConnectPhase, VariablesPhase, SlaveStatusPhase, LagQueryPhase, MasterStatusPhase, SlaveEnumerationPhase, BackendWritePhase}
+
+// DiscoveryPercentiles are the percentiles reported by ReadDiscoveryTimingPercentiles
+var DiscoveryPercentiles = []float64{50, 90, 95, 99}
+
+// DiscoveryTiming is the time, in milliseconds, spent in each phase of a single instance read
+type DiscoveryTiming struct {
+	Key				InstanceKey
+	Timestamp		string
+	PhaseMillis		map[DiscoveryPhase]float64
+	TotalMillis		float64
+	lapStart		time.Time
+}
+
+// NewDiscoveryTiming starts timing a read of given instance
+func NewDiscoveryTiming(instanceKey *InstanceKey) *DiscoveryTiming {
+	return &DiscoveryTiming{
+		Key:			*instanceKey,
+		Timestamp:		time.Now().Format("2006-01-02 15:04:05"),
+		PhaseMillis:	make(map[DiscoveryPhase]float64),
+		lapStart:		time.Now(),
+	}
+}
+
+// Lap accounts the time passed since previous lap (or since timing started) to given phase
+func (this *DiscoveryTiming) Lap(phase DiscoveryPhase) {
+	now := time.Now()
+	millis := float64(now.Sub(this.lapStart).Nanoseconds()) / float64(time.Millisecond)
+	this.PhaseMillis[phase] += millis
+	this.TotalMillis += millis
+	this.lapStart = now
+}
+
+// Skip restarts the lap clock without accounting the time passed to any phase
+func (this *DiscoveryTiming) Skip() {
+	this.lapStart = time.Now()
+}
+
+// DiscoveryTimingSummary sums up the recent timings of a single instance
+type DiscoveryTimingSummary struct {
+	Key					InstanceKey
+	Samples				int
+	AverageMillis		float64
+	MaxMillis			float64
+	LastTimestamp		string
+	AveragePhaseMillis	map[DiscoveryPhase]float64
+}
+
+// DiscoveryTimingPercentile is the given percentile of a phase's duration, across all recent timings of all instances
+type DiscoveryTimingPercentile struct {
+	Phase			DiscoveryPhase
+	Percentile		float64
+	Millis			float64
+}
+
+// DiscoveryTimings lists recent timings per instance, oldest first
+type DiscoveryTimings map[InstanceKey][]DiscoveryTiming
+
+// recentDiscoveryTimings keeps the last DiscoveryTimingSamplesPerInstance timings per instance of this process
+var recentDiscoveryTimings DiscoveryTimings = make(DiscoveryTimings)
+var recentDiscoveryTimingsMutex sync.Mutex
+
+// RecordDiscoveryTiming stores a completed timing, discarding the instance's oldest timing if needed
+func RecordDiscoveryTiming(timing *DiscoveryTiming) {
+	recentDiscoveryTimingsMutex.Lock()
+	defer recentDiscoveryTimingsMutex.Unlock()
+
+	timings := append(recentDiscoveryTimings[timing.Key], *timing)
+	if maxSamples := int(config.Config.DiscoveryTimingSamplesPerInstance); maxSamples > 0 && len(timings) > maxSamples {
+		timings = timings[len(timings) - maxSamples:]
+	}
+	recentDiscoveryTimings[timing.Key] = timings
+}
+
+// ForgetDiscoveryTimings removes timings of given instance
+func ForgetDiscoveryTimings(instanceKey *InstanceKey) {
+	recentDiscoveryTimingsMutex.Lock()
+	defer recentDiscoveryTimingsMutex.Unlock()
+
+	delete(recentDiscoveryTimings, *instanceKey)
+}
+
+// ReadDiscoveryTimings returns recent timings of given instance, newest first
+func ReadDiscoveryTimings(instanceKey *InstanceKey) []DiscoveryTiming {
+	recentDiscoveryTimingsMutex.Lock()
+	defer recentDiscoveryTimingsMutex.Unlock()
+
+	timings := recentDiscoveryTimings[*instanceKey]
+	res := []DiscoveryTiming{}
+	for i := len(timings) - 1; i >= 0; i-- {
+		res = append(res, timings[i])
+	}
+	return res
+}
+
+// summarizeDiscoveryTimings averages given timings of a single instance
+func summarizeDiscoveryTimings(instanceKey InstanceKey, timings []DiscoveryTiming) DiscoveryTimingSummary {
+	summary := DiscoveryTimingSummary{Key: instanceKey, Samples: len(timings), AveragePhaseMillis: make(map[DiscoveryPhase]float64)}
+	for _, timing := range timings {
+		summary.AverageMillis += timing.TotalMillis
+		summary.MaxMillis = math.Max(summary.MaxMillis, timing.TotalMillis)
+		summary.LastTimestamp = timing.Timestamp
+		for phase, millis := range timing.PhaseMillis {
+			summary.AveragePhaseMillis[phase] += millis
+		}
+	}
+	if len(timings) > 0 {
+		summary.AverageMillis /= float64(len(timings))
+		for phase := range summary.AveragePhaseMillis {
+			summary.AveragePhaseMillis[phase] /= float64(len(timings))
+		}
+	}
+	return summary
+}
+
+type discoveryTimingSummariesByAverage []DiscoveryTimingSummary
+
+func (this discoveryTimingSummariesByAverage) Len() int		{ return len(this) }
+func (this discoveryTimingSummariesByAverage) Swap(i, j int)	{ this[i], this[j] = this[j], this[i] }
+func (this discoveryTimingSummariesByAverage) Less(i, j int) bool {
+	return this[i].AverageMillis > this[j].AverageMillis
+}
+
+// copyRecentDiscoveryTimings returns a snapshot of this process' recent timings
+func copyRecentDiscoveryTimings() DiscoveryTimings {
+	recentDiscoveryTimingsMutex.Lock()
+	defer recentDiscoveryTimingsMutex.Unlock()
+
+	res := make(DiscoveryTimings)
+	for instanceKey, timings := range recentDiscoveryTimings {
+		res[instanceKey] = append([]DiscoveryTiming{}, timings...)
+	}
+	return res
+}
+
+// ReadSlowestDiscoveryInstances returns up to `count` instances with the highest average read time in this
+// process, slowest first. A non-positive count returns all instances.
+func ReadSlowestDiscoveryInstances(count int) []DiscoveryTimingSummary {
+	return copyRecentDiscoveryTimings().SlowestInstances(count)
+}
+
+// SlowestInstances returns up to `count` instances with the highest average read time, slowest first.
+// A non-positive count returns all instances.
+func (this DiscoveryTimings) SlowestInstances(count int) []DiscoveryTimingSummary {
+	summaries := []DiscoveryTimingSummary{}
+	for instanceKey, timings := range this {
+		summaries = append(summaries, summarizeDiscoveryTimings(instanceKey, timings))
+	}
+
+	sort.Sort(discoveryTimingSummariesByAverage(summaries))
+	if count > 0 && len(summaries) > count {
+		summaries = summaries[:count]
+	}
+	return summaries
+}
+
+// percentile returns the given percentile (nearest rank) of given sorted values
+func percentile(sortedValues []float64, percentile float64) float64 {
+	if len(sortedValues) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(percentile / 100 * float64(len(sortedValues))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sortedValues[rank - 1]
+}
+
+// ReadDiscoveryTimingPercentiles returns DiscoveryPercentiles of each phase, and of total read time,
+// across recent timings of all instances in this process
+func ReadDiscoveryTimingPercentiles() []DiscoveryTimingPercentile {
+	return copyRecentDiscoveryTimings().Percentiles()
+}
+
+// Percentiles returns DiscoveryPercentiles of each phase, and of total read time, across all timings
+func (this DiscoveryTimings) Percentiles() []DiscoveryTimingPercentile {
+	phaseValues := make(map[DiscoveryPhase][]float64)
+	for _, timings := range this {
+		for _, timing := range timings {
+			for phase, millis := range timing.PhaseMillis {
+				phaseValues[phase] = append(phaseValues[phase], millis)
+			}
+			phaseValues[TotalPhase] = append(phaseValues[TotalPhase], timing.TotalMillis)
+		}
+	}
+
+	phases := append([]DiscoveryPhase{}, DiscoveryPhases...)
+	phases = append(phases, TotalPhase)
+	res := []DiscoveryTimingPercentile{}
+	for _, phase := range phases {
+		values, found := phaseValues[phase]
+		if !found {
+			continue
+		}
+		sort.Float64s(values)
+		for _, p := range DiscoveryPercentiles {
+			res = append(res, DiscoveryTimingPercentile{Phase: phase, Percentile: p, Millis: percentile(values, p)})
+		}
+	}
+	return res
+}
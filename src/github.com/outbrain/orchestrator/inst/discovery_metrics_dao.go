@@ -0,0 +1,145 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"strconv"
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/log"
+)
+
+// WriteDiscoveryTiming persists a completed timing, so that it can be reported by any process (e.g. the CLI).
+// Only the instance's timings retained in memory (see RecordDiscoveryTiming) are kept.
+func WriteDiscoveryTiming(timing *DiscoveryTiming) error {
+	phaseMillis, err := json.Marshal(timing.PhaseMillis)
+	if err != nil {return log.Errore(err)}
+
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			replace
+				into database_instance_discovery_timing (
+					hostname, port, timing_timestamp, total_millis, phase_millis
+				) VALUES (
+					?, ?, ?, ?, ?
+				)
+			`,
+			timing.Key.Hostname,
+		 	timing.Key.Port,
+		 	timing.Timestamp,
+		 	timing.TotalMillis,
+		 	string(phaseMillis),
+		 )
+	if err != nil {return log.Errore(err)}
+
+	retained := ReadDiscoveryTimings(&timing.Key)
+	if len(retained) == 0 {
+		return nil
+	}
+	_, err = sqlutils.Exec(db, `
+			delete
+				from database_instance_discovery_timing
+			where
+				hostname = ?
+				and port = ?
+				and timing_timestamp < ?
+			`,
+			timing.Key.Hostname,
+		 	timing.Key.Port,
+		 	retained[len(retained) - 1].Timestamp,
+		 )
+	return err
+}
+
+// deleteDiscoveryTimings removes persisted timings of given instance
+func deleteDiscoveryTimings(instanceKey *InstanceKey) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			delete
+				from database_instance_discovery_timing
+			where
+				hostname = ?
+				and port = ?
+			`,
+			instanceKey.Hostname,
+		 	instanceKey.Port,
+		 )
+	return err
+}
+
+// readStoredDiscoveryTimings returns persisted timings matching given condition, oldest first
+func readStoredDiscoveryTimings(condition string, args ...interface{}) (DiscoveryTimings, error) {
+	res := make(DiscoveryTimings)
+	query := `
+		select
+			hostname,
+			port,
+			timing_timestamp,
+			total_millis,
+			phase_millis
+		from
+			database_instance_discovery_timing
+		where
+			1=1
+			` + condition + `
+		order by
+			hostname, port, timing_timestamp
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	timing := DiscoveryTiming{PhaseMillis: make(map[DiscoveryPhase]float64)}
+    	timing.Key.Hostname = m.GetString("hostname")
+    	timing.Key.Port = m.GetInt("port")
+    	timing.Timestamp = m.GetString("timing_timestamp")
+    	timing.TotalMillis, _ = strconv.ParseFloat(m.GetString("total_millis"), 64)
+    	if err := json.Unmarshal([]byte(m.GetString("phase_millis")), &timing.PhaseMillis); err != nil {
+    		return err
+    	}
+    	res[timing.Key] = append(res[timing.Key], timing)
+    	return nil
+   	}, args...)
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// ReadStoredDiscoveryTimings returns the persisted recent timings of all instances, as written by all
+// discovering processes
+func ReadStoredDiscoveryTimings() (DiscoveryTimings, error) {
+	return readStoredDiscoveryTimings("")
+}
+
+// ReadStoredInstanceDiscoveryTimings returns the persisted recent timings of given instance, newest first
+func ReadStoredInstanceDiscoveryTimings(instanceKey *InstanceKey) ([]DiscoveryTiming, error) {
+	res := []DiscoveryTiming{}
+	timings, err := readStoredDiscoveryTimings("and hostname = ? and port = ?", instanceKey.Hostname, instanceKey.Port)
+	stored := timings[*instanceKey]
+	for i := len(stored) - 1; i >= 0; i-- {
+		res = append(res, stored[i])
+	}
+	return res, err
+}
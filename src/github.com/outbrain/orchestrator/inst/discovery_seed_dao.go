@@ -0,0 +1,150 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/log"
+)
+
+// RegisterDiscoverySeed records given instance as a discovery seed of given source. A seed which was
+// previously removed is reinstated. A seed listed by both config and file is kept as a config seed, such that
+// removing it from the file does not remove it.
+func RegisterDiscoverySeed(instanceKey *InstanceKey, seedSource string) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			insert
+				into discovery_seed (
+					hostname, port, seed_source, first_seen, last_seen, removed_timestamp
+				) VALUES (
+					?, ?, ?, NOW(), NOW(), NULL
+				)
+			on duplicate key update
+				seed_source = if(removed_timestamp is null and seed_source = ?, seed_source, values(seed_source)),
+				last_seen = values(last_seen),
+				removed_timestamp = NULL
+			`,
+			instanceKey.Hostname,
+		 	instanceKey.Port,
+		 	seedSource,
+		 	DiscoverySeedSourceConfig,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	return nil
+}
+
+// RemoveDiscoverySeed flags a seed of given source as removed (e.g. the entry is no longer listed in the seed file).
+// A seed of another source is unaffected. The entry is kept such that it can be presented to the user.
+func RemoveDiscoverySeed(instanceKey *InstanceKey, seedSource string) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	res, err := sqlutils.Exec(db, `
+			update
+				discovery_seed
+			set
+				removed_timestamp = NOW()
+			where
+				hostname = ?
+				and port = ?
+				and seed_source = ?
+				and removed_timestamp is null
+			`,
+			instanceKey.Hostname,
+		 	instanceKey.Port,
+		 	seedSource,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	if affected, _ := res.RowsAffected(); affected > 0 {
+		AuditOperation("remove-discovery-seed", instanceKey, "source: " + seedSource)
+	}
+	return nil
+}
+
+// ReadDiscoverySeeds returns the list of known discovery seeds, including removed ones
+func ReadDiscoverySeeds() ([]DiscoverySeed, error) {
+	res := []DiscoverySeed{}
+	query := `
+		select
+			hostname,
+			port,
+			seed_source,
+			first_seen,
+			last_seen,
+			removed_timestamp is not null as is_removed,
+			ifnull(removed_timestamp, '') as removed_timestamp
+		from
+			discovery_seed
+		order by
+			hostname, port
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	seed := DiscoverySeed{}
+    	seed.Key.Hostname = m.GetString("hostname")
+    	seed.Key.Port = m.GetInt("port")
+    	seed.SeedSource = m.GetString("seed_source")
+    	seed.FirstSeen = m.GetString("first_seen")
+    	seed.LastSeen = m.GetString("last_seen")
+    	seed.IsRemoved = m.GetBool("is_removed")
+    	seed.RemovedTimestamp = m.GetString("removed_timestamp")
+
+    	res = append(res, seed)
+    	return err
+   	})
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// ReadDiscoverySeedKeys returns the keys of current (not removed) discovery seeds of given source
+func ReadDiscoverySeedKeys(seedSource string) (InstanceKeyMap, error) {
+	res := make(InstanceKeyMap)
+	query := `
+		select
+			hostname,
+			port
+		from
+			discovery_seed
+		where
+			seed_source = ?
+			and removed_timestamp is null
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	res[InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")}] = true
+    	return nil
+   	}, seedSource)
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
@@ -0,0 +1,32 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+)
+
+// Downtime indicates an instance is known to be down or unhealthy for a period of time (e.g. under planned work),
+// and should not be reported as a problem nor be subject to recovery. As opposed to Maintenance,
+// it does not block topology operations.
+type Downtime struct {
+	Key					InstanceKey
+	Owner				string
+	Reason				string
+	BeginTimestamp		string
+	EndTimestamp		string
+	SecondsRemaining	uint
+}
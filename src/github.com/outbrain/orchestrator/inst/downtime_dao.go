@@ -0,0 +1,174 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"errors"
+	"time"
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/log"
+)
+
+// BeginDowntime marks given instance as downtimed for given duration. An existing downtime on the
+// instance is overridden.
+func BeginDowntime(instanceKey *InstanceKey, owner string, reason string, duration time.Duration) error {
+	if duration <= 0 {
+		return errors.New(fmt.Sprintf("Invalid downtime duration: %+v", duration))
+	}
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	durationSeconds := int64(duration.Seconds())
+	_, err = sqlutils.Exec(db, `
+			replace
+				into database_instance_downtime (
+					hostname, port, begin_timestamp, end_timestamp, owner, reason
+				) VALUES (
+					?, ?, NOW(), NOW() + interval ? second, ?, ?
+				)
+			`,
+			instanceKey.Hostname,
+		 	instanceKey.Port,
+		 	durationSeconds,
+		 	owner,
+		 	reason,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	AuditOwnedOperation("begin-downtime", instanceKey, owner, fmt.Sprintf("owner: %s, reason: %s, duration: %ds", owner, reason, durationSeconds))
+	return nil
+}
+
+// EndDowntime terminates an active downtime of given instance
+func EndDowntime(instanceKey *InstanceKey) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	res, err := sqlutils.Exec(db, `
+			delete
+				from database_instance_downtime
+			where
+				hostname = ?
+				and port = ?
+				and end_timestamp > NOW()
+			`,
+			instanceKey.Hostname,
+		 	instanceKey.Port,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		err = errors.New(fmt.Sprintf("Instance is not downtimed: %+v", instanceKey))
+	} else {
+		AuditOperation("end-downtime", instanceKey, "")
+	}
+	return err
+}
+
+// ExpireDowntime removes downtime entries past their end timestamp. Such entries are already
+// ineffective; this makes for cleanup and an audit trail.
+func ExpireDowntime() error {
+	downtimes, err := readDowntime(false)
+	if err != nil {return err}
+
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	for _, downtime := range downtimes {
+		res, err := sqlutils.Exec(db, `
+				delete
+					from database_instance_downtime
+				where
+					hostname = ?
+					and port = ?
+					and end_timestamp <= NOW()
+				`,
+				downtime.Key.Hostname,
+			 	downtime.Key.Port,
+			 )
+		if err != nil {return log.Errore(err)}
+		if affected, _ := res.RowsAffected(); affected > 0 {
+			AuditOwnedOperation("expire-downtime", &downtime.Key, downtime.Owner, fmt.Sprintf("owner: %s, reason: %s, ended: %s", downtime.Owner, downtime.Reason, downtime.EndTimestamp))
+		}
+	}
+	return nil
+}
+
+// readDowntime reads either active or expired downtime entries
+func readDowntime(active bool) ([]Downtime, error) {
+	res := []Downtime{}
+	condition := "end_timestamp > NOW()"
+	if !active {
+		condition = "end_timestamp <= NOW()"
+	}
+	query := `
+		select
+			hostname,
+			port,
+			owner,
+			reason,
+			begin_timestamp,
+			end_timestamp,
+			greatest(timestampdiff(second, NOW(), end_timestamp), 0) as seconds_remaining
+		from
+			database_instance_downtime
+		where
+			` + condition + `
+		order by
+			end_timestamp
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	downtime := Downtime{}
+    	downtime.Key.Hostname = m.GetString("hostname")
+    	downtime.Key.Port = m.GetInt("port")
+    	downtime.Owner = m.GetString("owner")
+    	downtime.Reason = m.GetString("reason")
+    	downtime.BeginTimestamp = m.GetString("begin_timestamp")
+    	downtime.EndTimestamp = m.GetString("end_timestamp")
+    	downtime.SecondsRemaining = m.GetUint("seconds_remaining")
+
+    	res = append(res, downtime)
+    	return nil
+   	})
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// ReadActiveDowntime returns the list of currently active downtime entries
+func ReadActiveDowntime() ([]Downtime, error) {
+	return readDowntime(true)
+}
+
+// ReadDowntimedInstanceKeys returns the keys of currently downtimed instances
+func ReadDowntimedInstanceKeys() (InstanceKeyMap, error) {
+	res := make(InstanceKeyMap)
+	downtimes, err := readDowntime(true)
+	if err != nil {return res, err}
+	for _, downtime := range downtimes {
+		res[downtime.Key] = true
+	}
+	return res, nil
+}
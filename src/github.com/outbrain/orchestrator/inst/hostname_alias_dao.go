@@ -0,0 +1,190 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"sync"
+	"time"
+	"database/sql"
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// HostnameAlias maps an alias (e.g. a VIP or DNS alias slaves use to connect to their master)
+// onto the canonical hostname of the instance it stands for.
+type HostnameAlias struct {
+	Alias			string
+	Hostname		string
+	LastRegistered	string
+}
+
+// cachedHostnameAlias is a cached lookup of an alias: the canonical hostname, or empty when not an alias
+type cachedHostnameAlias struct {
+	hostname	string
+	readTime	time.Time
+}
+
+// cachedHostnameAliases caches alias => canonical hostname lookups of the hostname_alias table, hits and misses
+// alike. An entry is trusted for InstancePollSeconds: by then an alias may have been learned, or may have moved
+// to another instance (e.g. a VIP moving to a new master), by any orchestrator node.
+var cachedHostnameAliases map[string]cachedHostnameAlias = make(map[string]cachedHostnameAlias)
+var cachedHostnameAliasesMutex sync.Mutex
+
+// getCachedHostnameAlias returns the cached lookup of given alias, if not expired
+func getCachedHostnameAlias(alias string) (string, bool) {
+	cachedHostnameAliasesMutex.Lock()
+	defer cachedHostnameAliasesMutex.Unlock()
+
+	cached, found := cachedHostnameAliases[alias]
+	if !found || time.Since(cached.readTime) >= time.Duration(config.Config.InstancePollSeconds) * time.Second {
+		return "", false
+	}
+	return cached.hostname, true
+}
+
+// cacheHostnameAlias caches the lookup of given alias; an empty hostname caches a miss
+func cacheHostnameAlias(alias string, hostname string) {
+	cachedHostnameAliasesMutex.Lock()
+	defer cachedHostnameAliasesMutex.Unlock()
+
+	cachedHostnameAliases[alias] = cachedHostnameAlias{hostname: hostname, readTime: time.Now()}
+}
+
+// RegisterHostnameAlias stores an alias => hostname pair in the orchestrator backend, unless recently registered
+func RegisterHostnameAlias(alias string, hostname string) error {
+	if alias == "" || hostname == "" || alias == hostname {
+		return nil
+	}
+	if knownHostname, found := getCachedHostnameAlias(alias); found && knownHostname == hostname {
+		return nil
+	}
+
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			replace
+				into hostname_alias (
+					alias, hostname, last_registered
+				) VALUES (
+					?, ?, NOW()
+				)
+			`,
+			alias,
+			hostname,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	cacheHostnameAlias(alias, hostname)
+	log.Infof("Registered hostname alias: %s => %s", alias, hostname)
+	return nil
+}
+
+// readHostnameAlias reads the canonical hostname for a given alias from the orchestrator backend.
+// An empty string is returned when no such alias is known.
+func readHostnameAlias(alias string) (string, error) {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return "", log.Errore(err)}
+
+	var hostname string
+	err = db.QueryRow(`
+		select
+			hostname
+		from
+			hostname_alias
+		where
+			alias = ?`,
+		alias).Scan(
+			&hostname,
+		)
+	if err == sql.ErrNoRows {return "", nil}
+	if err != nil {return "", log.Errore(err)}
+	return hostname, nil
+}
+
+// ResolveHostnameAlias returns the canonical hostname for the given hostname, which may or may not be
+// a known alias. Configured aliases take precedence over learned ones. Unknown hostnames are returned as is.
+func ResolveHostnameAlias(hostname string) string {
+	if canonical, found := config.Config.HostnameAliases[hostname]; found {
+		return canonical
+	}
+	if canonical, found := getCachedHostnameAlias(hostname); found {
+		if canonical == "" {
+			return hostname
+		}
+		return canonical
+	}
+	canonical, err := readHostnameAlias(hostname)
+	if err != nil {
+		return hostname
+	}
+	cacheHostnameAlias(hostname, canonical)
+	if canonical == "" {
+		return hostname
+	}
+	return canonical
+}
+
+// ResolveInstanceKeyAlias returns an instance key with canonical hostname (see ResolveHostnameAlias)
+func ResolveInstanceKeyAlias(instanceKey *InstanceKey) *InstanceKey {
+	return &InstanceKey{Hostname: ResolveHostnameAlias(instanceKey.Hostname), Port: instanceKey.Port}
+}
+
+// UnresolveHostname is the reverse of ResolveHostnameAlias: it returns the name by which slaves are to connect
+// to given canonical hostname, as explicitly configured in HostnameUnresolves, or the hostname itself.
+// Learned aliases are never used: a learned alias may be stale, or may not be reachable by slaves.
+func UnresolveHostname(hostname string) string {
+	if alias, found := config.Config.HostnameUnresolves[hostname]; found {
+		return alias
+	}
+	return hostname
+}
+
+// ReadHostnameAliases returns all learned hostname aliases
+func ReadHostnameAliases() ([]HostnameAlias, error) {
+	res := []HostnameAlias{}
+	query := `
+		select
+			alias,
+			hostname,
+			last_registered
+		from
+			hostname_alias
+		order by
+			hostname, alias
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	hostnameAlias := HostnameAlias{}
+    	hostnameAlias.Alias = m.GetString("alias")
+    	hostnameAlias.Hostname = m.GetString("hostname")
+    	hostnameAlias.LastRegistered = m.GetString("last_registered")
+
+    	res = append(res, hostnameAlias)
+    	return err
+   	})
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
@@ -24,7 +24,6 @@ import (
 	"errors"
 	"database/sql"
 	"encoding/json"
-	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/log"
 )
 
@@ -143,14 +142,25 @@ type Instance struct {
 	MasterKey			InstanceKey
 	Slave_SQL_Running	bool
 	Slave_IO_Running	bool
+	LastIOErrno			int
+	LastIOError			string
+	LastIOErrorTimestamp	string
+	LastSQLErrno		int
+	LastSQLError		string
+	LastSQLErrorTimestamp	string
 	ReadBinlogCoordinates	BinlogCoordinates
 	ExecBinlogCoordinates	BinlogCoordinates
 	SecondsBehindMaster		sql.NullInt64
 	SlaveLagSeconds			sql.NullInt64
 	SlaveHosts			InstanceKeyMap
 	ClusterName			string
+	DataCenter			string
+	PhysicalEnvironment	string
+	UsesSSL				bool
+	MasterSSLAllowed	bool
 	
 	IsLastCheckValid	bool
+	IsUnreachable		bool
 	IsUpToDate			bool
 	IsRecentlyChecked	bool
 	SecondsSinceLastSeen	sql.NullInt64
@@ -189,6 +199,35 @@ func (this *Instance) IsSmallerMajorVersion(other *Instance) bool {
 	return false
 }
 
+// HumanReadableDescription returns the instance's key, along with its data center, if known
+func (this *Instance) HumanReadableDescription() string {
+	if this.DataCenter == "" {
+		return this.Key.DisplayString()
+	}
+	return fmt.Sprintf("%s [%s]", this.Key.DisplayString(), this.DataCenter)
+}
+
+// IsSmallerVersion tests this instance against another and returns true if this instance is of a smaller
+// full version. e.g. 5.5.9 is smaller than 5.5.36-log
+func (this *Instance) IsSmallerVersion(other *Instance) bool {
+	versionToken := func(token string) int {
+		digits := strings.TrimRightFunc(token, func(r rune) bool {return r < '0' || r > '9'})
+		digits = strings.SplitN(digits, "-", 2)[0]
+		value, _ := strconv.Atoi(digits)
+		return value
+	}
+	thisVersion := strings.Split(this.Version, ".")
+	otherVersion := strings.Split(other.Version, ".")
+	for i := 0 ; i < len(thisVersion) && i < len(otherVersion); i++ {
+		this_token := versionToken(thisVersion[i])
+		other_token := versionToken(otherVersion[i])
+		if this_token != other_token {
+			return this_token < other_token
+		}
+	}
+	return len(thisVersion) < len(otherVersion)
+}
+
 // IsSlave makes simple heuristics to decide whether this insatnce is a slave of another instance
 func (this *Instance) IsSlave() bool {
 	return this.MasterKey.Hostname != "" && this.MasterKey.Port != 0 && this.ReadBinlogCoordinates.LogFile != ""
@@ -265,7 +304,7 @@ func (this *Instance) CanReplicateFrom(other *Instance) (bool, error) {
 }
 
 // CanMove returns true if this instance's state allows it to be repositioned. For example,
-// if this instance lags too much, it will not be moveable.
+// if this instance lags too much (by its cluster's standards), it will not be moveable.
 func (this *Instance) CanMove() (bool, error) {
 	if !this.IsLastCheckValid {
 		return false, errors.New("last check invalid") 
@@ -282,7 +321,7 @@ func (this *Instance) CanMove() (bool, error) {
 	if !this.SecondsBehindMaster.Valid {
 		return false, errors.New("cannot determine slave lag") 
 	}
-	if this.SecondsBehindMaster.Int64 > int64(config.Config.ReasonableMaintenanceReplicationLagSeconds) {
+	if this.SecondsBehindMaster.Int64 > int64(ReadClusterConfiguration(this.ClusterName).ReasonableMaintenanceReplicationLagSeconds) {
 		return false, errors.New("lags too much") 
 	}
 	return true, nil
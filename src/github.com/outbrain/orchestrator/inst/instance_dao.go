@@ -21,7 +21,10 @@ import (
 	"errors"
 	"time"
 	"strings"
+	"regexp"
+	"net"
 	"database/sql"
+	"database/sql/driver"
 	"github.com/outbrain/sqlutils"
 	"github.com/outbrain/orchestrator/db"
 	"github.com/outbrain/orchestrator/config"
@@ -49,6 +52,44 @@ func ScanInstanceRow(instanceKey *InstanceKey, query string, dest ...interface{}
 }
 
 
+// IsUnreachableError returns true when given error indicates the instance could not be connected to,
+// or did not respond in time; as opposed to an error reported by the instance itself.
+func IsUnreachableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	if err == driver.ErrBadConn {
+		return true
+	}
+	return strings.Contains(err.Error(), "i/o timeout")
+}
+
+
+// detectInstanceAttribute returns an instance attribute (e.g. data center) either by running given query
+// on the topology instance, or by extracting the first capture group of given compiled pattern (may be nil)
+// applied on hostname. The query, if given, takes precedence. An empty string is returned when the attribute
+// cannot be detected.
+func detectInstanceAttribute(db *sql.DB, query string, pattern *regexp.Regexp, hostname string) string {
+	if query != "" {
+		var attribute string
+		if err := db.QueryRow(query).Scan(&attribute); err != nil {
+			log.Errore(err)
+			return ""
+		}
+		return attribute
+	}
+	if pattern != nil {
+		if submatch := pattern.FindStringSubmatch(hostname); len(submatch) > 1 {
+			return submatch[1]
+		}
+	}
+	return ""
+}
+
+
 // ReadTopologyInstance connects to a topology MySQL instance and reads its configuration and 
 // replication status. It writes read info into orchestrator's backend.
 func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
@@ -58,13 +99,23 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
         }
     }()
 
+	if IsDiscoveryIgnoredInstance(instanceKey) {
+		return nil, errors.New(fmt.Sprintf("instance is filtered out by DiscoveryIgnoreHostnameFilters: %+v", *instanceKey))
+	}
+
 	instance := NewInstance()
 	instanceFound := false;
     foundBySlaveHosts := false
+    var reportHost sql.NullString
+    timing := NewDiscoveryTiming(instanceKey)
 
 
 	db,	err	:=	db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
 
+    if err != nil {goto Cleanup}
+    // The driver connects lazily; a ping makes for the actual connection time
+    err = db.Ping()
+    timing.Lap(ConnectPhase)
     if err != nil {goto Cleanup}
 
    	instance.Key = *instanceKey
@@ -72,9 +123,30 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
        	&instance.ServerID, &instance.Version, &instance.Binlog_format, &instance.LogBinEnabled, &instance.LogSlaveUpdatesEnabled)
     if err != nil {goto Cleanup}
     instanceFound = true
+    // report_host is optional; failing to read it does not fail the instance read
+    _ = db.QueryRow("select @@global.report_host").Scan(&reportHost)
+    instance.DataCenter = detectInstanceAttribute(db, config.Config.DetectDataCenterQuery, config.Config.DataCenterRegexp(), instance.Key.Hostname)
+    instance.PhysicalEnvironment = detectInstanceAttribute(db, config.Config.DetectPhysicalEnvironmentQuery, config.Config.PhysicalEnvironmentRegexp(), instance.Key.Hostname)
+    // A non-empty Ssl_cipher indicates our own connection is encrypted. This is optional; failing to read it
+    // does not fail the instance read
+    if sslErr := sqlutils.QueryRowsMap(db, "show session status like 'Ssl_cipher'", func(m sqlutils.RowMap) error {
+    	instance.UsesSSL = (m.GetString("Value") != "")
+    	return nil
+    }); sslErr != nil {
+    	log.Errore(sslErr)
+    }
+    timing.Lap(VariablesPhase)
     err = sqlutils.QueryRowsMap(db, "show slave status", func(m sqlutils.RowMap) error {
 		instance.Slave_IO_Running = (m.GetString("Slave_IO_Running") == "Yes")
       	instance.Slave_SQL_Running = (m.GetString("Slave_SQL_Running") == "Yes")
+      	instance.MasterSSLAllowed = (m.GetString("Master_SSL_Allowed") == "Yes")
+      	instance.LastIOErrno = m.GetInt("Last_IO_Errno")
+      	instance.LastIOError = m.GetString("Last_IO_Error")
+      	// Error timestamps are only reported as of MySQL 5.6
+      	instance.LastIOErrorTimestamp = m.GetString("Last_IO_Error_Timestamp")
+      	instance.LastSQLErrno = m.GetInt("Last_SQL_Errno")
+      	instance.LastSQLError = m.GetString("Last_SQL_Error")
+      	instance.LastSQLErrorTimestamp = m.GetString("Last_SQL_Error_Timestamp")
        	instance.ReadBinlogCoordinates.LogFile = m.GetString("Master_Log_File")
        	instance.ReadBinlogCoordinates.LogPos = m.GetInt64("Read_Master_Log_Pos")
        	instance.ExecBinlogCoordinates.LogFile = m.GetString("Relay_Master_Log_File")
@@ -82,19 +154,29 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 
        	masterKey, err := NewInstanceKeyFromStrings(m.GetString("Master_Host"), m.GetString("Master_Port")) 
        	if err != nil {log.Errore(err)}
-       	instance.MasterKey = *masterKey
+       	// Slaves may connect to their master via VIP/alias; we want the master's canonical name
+       	instance.MasterKey = *ResolveInstanceKeyAlias(masterKey)
    		instance.SecondsBehindMaster = m.GetNullInt64("Seconds_Behind_Master")
-       	if config.Config.SlaveLagQuery == "" {
-       		instance.SlaveLagSeconds = instance.SecondsBehindMaster
-        }
         // Not breaking the flow even on error
        	return nil
    	})
+    timing.Lap(SlaveStatusPhase)
+    if err != nil {goto Cleanup}
+    if instance.IsSlave() && IsDiscoveryIgnoredMaster(&instance.Key, &instance.MasterKey) {
+    	// Filtered instances are not written to the backend
+    	return nil, errors.New(fmt.Sprintf("instance is filtered out by DiscoveryIgnoreMasterHostnameFilters: %+v", *instanceKey))
+    }
+
+	// The cluster is needed early on, as it determines the lag query
+	instance.ClusterName, err = ReadClusterNameByMaster(&instance.Key, &instance.MasterKey)
     if err != nil {goto Cleanup}
 
-	if config.Config.SlaveLagQuery != "" {
-		err = db.QueryRow(config.Config.SlaveLagQuery).Scan(&instance.SlaveLagSeconds)
+	if slaveLagQuery := ReadClusterConfiguration(instance.ClusterName).SlaveLagQuery; slaveLagQuery != "" {
+		err = db.QueryRow(slaveLagQuery).Scan(&instance.SlaveLagSeconds)
+		timing.Lap(LagQueryPhase)
 	    if err != nil {goto Cleanup}
+	} else {
+		instance.SlaveLagSeconds = instance.SecondsBehindMaster
 	}
         
     err = sqlutils.QueryRowsMap(db, "show master status", func(m sqlutils.RowMap) error {
@@ -103,6 +185,7 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
        	instance.SelfBinlogCoordinates.LogPos = m.GetInt64("Position")
        	return err
    	})
+    timing.Lap(MasterStatusPhase)
     if err != nil {goto Cleanup}
         
     // Get slaves, either by SHOW SLAVE HOSTS or via PROCESSLIST
@@ -110,6 +193,9 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
         err = sqlutils.QueryRowsMap(db, `show slave hosts`, 
         		func(m sqlutils.RowMap) error {
         			slaveKey, err := NewInstanceKeyFromStrings(m.GetString("Host"), m.GetString("Port")) 
+        			if err == nil && IsDiscoveryIgnoredInstance(slaveKey) {
+        				return nil
+        			}
         			if err == nil {
 						instance.AddSlaveKey(slaveKey)
 						foundBySlaveHosts = true
@@ -133,24 +219,59 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
         			cname, err := GetCNAME(m.GetString("slave_hostname"))
         			if err != nil {return err}
         			slaveKey := InstanceKey{Hostname: cname, Port: instance.Key.Port}
+        			if IsDiscoveryIgnoredInstance(&slaveKey) {
+        				return nil
+        			}
 					instance.AddSlaveKey(&slaveKey)
 					return err
 		       	})
 			
         if err != nil {goto Cleanup}
 	}
+    timing.Lap(SlaveEnumerationPhase)
     if err != nil {goto Cleanup}
 
-	instance.ClusterName, err = ReadClusterNameByMaster(&instance.Key, &instance.MasterKey)
-    if err != nil {goto Cleanup}
+    if len(instance.SlaveHosts) > 0 && reportHost.Valid {
+    	// A master advertising a report_host other than its own name is known to its slaves by that name
+    	RegisterHostnameAlias(reportHost.String, instance.Key.Hostname)
+    }
+
+	if config.Config.DetectClusterAliasQuery != "" && !instance.IsSlave() {
+		// This is a topology master: it is the one to tell us the cluster's alias
+		var clusterAlias string
+		if aliasErr := db.QueryRow(config.Config.DetectClusterAliasQuery).Scan(&clusterAlias); aliasErr != nil {
+			log.Errore(aliasErr)
+		} else if clusterAlias != "" {
+			WriteClusterAlias(instance.ClusterName, clusterAlias)
+		}
+	}
 
 	Cleanup:
 	if instanceFound {
+		if err == nil {
+			// Only compare a fully read instance
+			_ = RecordInstanceEvents(instance)
+		}
+		timing.Skip()
 		_ = WriteInstance(instance, err)
+		if err == nil {
+			_ = WriteLagSample(instance)
+		}
 	} else {
-		_ = UpdateInstanceLastChecked(instanceKey)
+		instance.IsUnreachable = IsUnreachableError(err)
+		if instance.IsUnreachable {
+			// e.g. access denied or a TLS misconfiguration do not make for an unreachable instance
+			_ = RecordInstanceUnreachable(instanceKey)
+		}
+		timing.Skip()
+		_ = UpdateInstanceLastChecked(instanceKey, instance.IsUnreachable)
 	}
-	if err	!=	nil	{
+	timing.Lap(BackendWritePhase)
+	RecordDiscoveryTiming(timing)
+	WriteDiscoveryTiming(timing)
+	if instance.IsUnreachable {
+		log.Warningf("Unreachable instance %+v: %+v", *instanceKey, err)
+	} else if err	!=	nil	{
 		log.Errore(err)
 	}
 	return instance, err
@@ -162,6 +283,7 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 // It is a non-recursive function and so-called-recursion is performed upon periodic reading of 
 // instances.
 func ReadClusterNameByMaster(instanceKey *InstanceKey, masterKey *InstanceKey) (string, error) {
+	masterKey = ResolveInstanceKeyAlias(masterKey)
 	db,	err	:=	db.OpenOrchestrator()
 	if	err	!=	nil	{
 		return "", log.Errore(err)
@@ -188,6 +310,68 @@ func ReadClusterNameByMaster(instanceKey *InstanceKey, masterKey *InstanceKey) (
 }
 
 
+// RecomputeClusterNames rewrites the cluster name of all known instances, based on the stored master edges
+// (see ComputeClusterNames). As opposed to ReadClusterNameByMaster, this applies to an entire subtree at once,
+// e.g. right after a topology change. Returns the number of instances whose cluster name changed.
+func RecomputeClusterNames() (int, error) {
+	masters := make(map[InstanceKey]InstanceKey)
+	currentClusterNames := make(map[InstanceKey]string)
+	changedCount := 0
+	query := `
+		select
+			hostname,
+			port,
+			master_host,
+			master_port,
+			cluster_name
+		from
+			database_instance
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	instanceKey := InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")}
+    	masterKey := InstanceKey{Hostname: m.GetString("master_host"), Port: m.GetInt("master_port")}
+    	masters[instanceKey] = *ResolveInstanceKeyAlias(&masterKey)
+    	currentClusterNames[instanceKey] = m.GetString("cluster_name")
+    	return nil
+   	})
+    if err != nil {goto Cleanup}
+
+	for instanceKey, clusterName := range ComputeClusterNames(masters) {
+		if clusterName == currentClusterNames[instanceKey] {
+			continue
+		}
+		_, err = sqlutils.Exec(db, `
+				update
+					database_instance
+				set
+					cluster_name = ?
+				where
+					hostname = ?
+					and port = ?
+				`,
+				clusterName,
+				instanceKey.Hostname,
+				instanceKey.Port,
+			 )
+		if err != nil {goto Cleanup}
+		log.Debugf("Cluster name of %+v: %s => %s", instanceKey, currentClusterNames[instanceKey], clusterName)
+		changedCount++
+	}
+	if changedCount > 0 {
+		log.Infof("Recomputed cluster names: %d instances changed", changedCount)
+	}
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return changedCount, err
+}
+
+
 // ReadInstance reads an instance from the orchestrator backend database
 func ReadInstance(instanceKey *InstanceKey) (*Instance, bool, error) {
 	db,	err	:=	db.OpenOrchestrator()
@@ -221,8 +405,19 @@ func ReadInstance(instanceKey *InstanceKey) (*Instance, bool, error) {
 			slave_lag_seconds,
 			slave_hosts,
 			cluster_name,
+			data_center,
+			physical_environment,
 			timestampdiff(second, last_checked, now()) as seconds_since_last_checked,
 			(last_checked <= last_seen) is true as is_last_check_valid,
+			is_unreachable,
+			uses_ssl,
+			master_ssl_allowed,
+			last_io_errno,
+			last_io_error,
+			last_io_error_timestamp,
+			last_sql_errno,
+			last_sql_error,
+			last_sql_error_timestamp,
 			timestampdiff(second, last_seen, now()) as seconds_since_last_seen
 		 from database_instance 
 		 	where hostname=? and port=?`, 
@@ -246,8 +441,19 @@ func ReadInstance(instanceKey *InstanceKey) (*Instance, bool, error) {
 		 	&instance.SlaveLagSeconds,
 		 	&slaveHostsJson,
 		 	&instance.ClusterName,
+		 	&instance.DataCenter,
+		 	&instance.PhysicalEnvironment,
 		 	&secondsSinceLastChecked,
 		 	&instance.IsLastCheckValid,
+		 	&instance.IsUnreachable,
+		 	&instance.UsesSSL,
+		 	&instance.MasterSSLAllowed,
+		 	&instance.LastIOErrno,
+		 	&instance.LastIOError,
+		 	&instance.LastIOErrorTimestamp,
+		 	&instance.LastSQLErrno,
+		 	&instance.LastSQLError,
+		 	&instance.LastSQLErrorTimestamp,
 		 	&instance.SecondsSinceLastSeen,
 		)
 	if err == sql.ErrNoRows {log.Infof("No entry for %+v", instanceKey); return instance, false, err}	
@@ -292,9 +498,20 @@ func readInstanceRow(m sqlutils.RowMap) *Instance {
  	instance.SlaveLagSeconds = m.GetNullInt64("slave_lag_seconds")
  	slaveHostsJson := m.GetString("slave_hosts")
  	instance.ClusterName = m.GetString("cluster_name")
+ 	instance.DataCenter = m.GetString("data_center")
+ 	instance.PhysicalEnvironment = m.GetString("physical_environment")
  	instance.IsUpToDate = (m.GetUint("seconds_since_last_checked") <= config.Config.InstancePollSeconds) 
 	instance.IsRecentlyChecked = (m.GetUint("seconds_since_last_checked") <= config.Config.InstancePollSeconds * 5) 
  	instance.IsLastCheckValid = m.GetBool("is_last_check_valid")
+ 	instance.IsUnreachable = m.GetBool("is_unreachable")
+ 	instance.UsesSSL = m.GetBool("uses_ssl")
+ 	instance.MasterSSLAllowed = m.GetBool("master_ssl_allowed")
+ 	instance.LastIOErrno = m.GetInt("last_io_errno")
+ 	instance.LastIOError = m.GetString("last_io_error")
+ 	instance.LastIOErrorTimestamp = m.GetString("last_io_error_timestamp")
+ 	instance.LastSQLErrno = m.GetInt("last_sql_errno")
+ 	instance.LastSQLError = m.GetString("last_sql_error")
+ 	instance.LastSQLErrorTimestamp = m.GetString("last_sql_error_timestamp")
  	instance.SecondsSinceLastSeen = m.GetNullInt64("seconds_since_last_seen")
  	
  	instance.ReadSlaveHostsFromJson(slaveHostsJson)
@@ -302,10 +519,15 @@ func readInstanceRow(m sqlutils.RowMap) *Instance {
 }
 
 
-// ReadClusterInstances reads all instances of a given cluster
-func ReadClusterInstances(clusterName string) ([](*Instance), error) {
+// ReadClusterInstances reads all instances of a given cluster, satisfying given tag selectors (may be empty).
+// The cluster may be given by name or by alias.
+func ReadClusterInstances(clusterName string, tagSelectors string) ([](*Instance), error) {
 	instances := [](*Instance){}
 
+	clusterName, err := ReadClusterNameByAlias(clusterName)
+	if	err	!=	nil	{
+		return instances, err
+	}
 	db,	err	:=	db.OpenOrchestrator()
 	if	err	!=	nil	{
 		return instances, log.Errore(err)
@@ -332,6 +554,42 @@ func ReadClusterInstances(clusterName string) ([](*Instance), error) {
     	instances = append(instances, instance)
     	return nil       	
    	})
+	if err != nil {
+		return instances, err
+	}
+
+	return FilterInstancesByTags(instances, tagSelectors)
+}
+
+
+// ReadSlaveInstances reads all slaves of a given master
+func ReadSlaveInstances(masterKey *InstanceKey) ([](*Instance), error) {
+	instances := [](*Instance){}
+
+	db,	err	:=	db.OpenOrchestrator()
+	if	err	!=	nil	{
+		return instances, log.Errore(err)
+	}
+
+	query := `
+		select 
+			*,
+			timestampdiff(second, last_checked, now()) as seconds_since_last_checked,
+			(last_checked <= last_seen) is true as is_last_check_valid,
+			timestampdiff(second, last_seen, now()) as seconds_since_last_seen
+		from 
+			database_instance 
+		where
+			master_host = ?
+			and master_port = ?
+		order by
+			hostname, port`
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		instance := readInstanceRow(m)
+    	instances = append(instances, instance)
+    	return nil       	
+   	}, masterKey.Hostname, masterKey.Port)
 
 	return instances, err
 }
@@ -355,16 +613,33 @@ func ReadProblemInstances() ([](*Instance), error) {
 		from 
 			database_instance 
 		where
-			(last_seen < last_checked)
-			or (not ifnull(timestampdiff(second, last_checked, now()) <= %d, false))
-			or (not slave_sql_running)
-			or (not slave_io_running)
-			or (seconds_behind_master > 10)
+			(
+				(last_seen < last_checked)
+				or (not ifnull(timestampdiff(second, last_checked, now()) <= %d, false))
+				or (not slave_sql_running)
+				or (not slave_io_running)
+				or (slave_lag_seconds > %d)
+			)
+			and (hostname, port) not in (
+				select hostname, port from database_instance_downtime where end_timestamp > now()
+			)
 		order by
-			hostname, port`, config.Config.InstancePollSeconds)
+			hostname, port`, config.Config.InstancePollSeconds, config.Config.MinReasonableReplicationLagSeconds())
 
+	clusterConfigurations := make(map[string]*config.ClusterConfiguration)
     err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
 		instance := readInstanceRow(m)
+		if instance.IsLastCheckValid && instance.IsUpToDate && instance.Slave_SQL_Running && instance.Slave_IO_Running {
+			// Only listed due to lag: evaluate against own cluster's threshold
+			clusterConfiguration, found := clusterConfigurations[instance.ClusterName]
+			if !found {
+				clusterConfiguration = ReadClusterConfiguration(instance.ClusterName)
+				clusterConfigurations[instance.ClusterName] = clusterConfiguration
+			}
+			if instance.SlaveLagSeconds.Int64 <= int64(clusterConfiguration.ReasonableReplicationLagSeconds) {
+				return nil
+			}
+		}
     	instances = append(instances, instance)
     	return nil       	
    	})
@@ -373,8 +648,9 @@ func ReadProblemInstances() ([](*Instance), error) {
 }
 
 
-// SearchInstances reads all instances qualifying for some searchString
-func SearchInstances(searchString string) ([](*Instance), error) {
+// SearchInstances reads all instances qualifying for some searchString and satisfying given tag selectors
+// (may be empty)
+func SearchInstances(searchString string, tagSelectors string) ([](*Instance), error) {
 	instances := [](*Instance){}
 
 	db,	err	:=	db.OpenOrchestrator()
@@ -400,6 +676,10 @@ func SearchInstances(searchString string) ([](*Instance), error) {
 			or version like '%%%s%%'
 			or port = '%s'
 			or concat(hostname, ':', port) like '%%%s%%'
+			or data_center = ?
+			or physical_environment = ?
+			or (last_io_errno != 0 and last_io_errno = ?)
+			or (last_sql_errno != 0 and last_sql_errno = ?)
 		order by
 			cluster_name,
 			hostname, port`, searchString, searchString, searchString, searchString, searchString, searchString)
@@ -407,9 +687,34 @@ func SearchInstances(searchString string) ([](*Instance), error) {
 		instance := readInstanceRow(m)
     	instances = append(instances, instance)
     	return nil       	
-   	})
+   	}, searchString, searchString, searchString, searchString)
+	if err != nil {
+		return instances, err
+	}
 
-	return instances, err
+	return FilterInstancesByTags(instances, tagSelectors)
+}
+
+
+// FilterInstancesByDataCenter returns those of given instances which are in given data center
+func FilterInstancesByDataCenter(instances [](*Instance), dataCenter string) [](*Instance) {
+	res := [](*Instance){}
+	for _, instance := range instances {
+		if instance.DataCenter == dataCenter {
+			res = append(res, instance)
+		}
+	}
+	return res
+}
+
+
+// GroupInstancesByDataCenter maps data center names onto their instances
+func GroupInstancesByDataCenter(instances [](*Instance)) map[string]([](*Instance)) {
+	res := make(map[string]([](*Instance)))
+	for _, instance := range instances {
+		res[instance.DataCenter] = append(res[instance.DataCenter], instance)
+	}
+	return res
 }
 
 
@@ -439,6 +744,60 @@ func ReadClusters() ([]string, error) {
 }
 
 
+// ReadClustersInfo reads names and aliases of all known clusters
+func ReadClustersInfo() ([]ClusterInfo, error) {
+	clusters := []ClusterInfo{}
+
+	db,	err	:=	db.OpenOrchestrator()
+	if	err	!=	nil	{
+		return clusters, log.Errore(err)
+	}
+
+	query := `
+		select
+			database_instance.cluster_name,
+			ifnull(max(cluster_alias.alias), '') as cluster_alias
+		from
+			database_instance
+			left join cluster_alias on (database_instance.cluster_name = cluster_alias.cluster_name)
+		group by
+			database_instance.cluster_name`
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	clusters = append(clusters, ClusterInfo{ClusterName: m.GetString("cluster_name"), ClusterAlias: m.GetString("cluster_alias")})
+    	return nil
+   	})
+
+	return clusters, err
+}
+
+
+// ReadAllInstanceKeys reads and returns keys of all known instances
+func ReadAllInstanceKeys() ([]InstanceKey, error) {
+	res := []InstanceKey{}
+	query := `
+		select 
+			hostname, port 
+		from 
+			database_instance
+		order by
+			hostname, port`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+    
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	res = append(res, InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")})
+    	return nil       	
+   	})
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+
 // ReadOutdatedInstanceKeys reads and returns keys for all instances that are not up to date (i.e.
 // pre-configured time has passed since they were last cheked)
 func ReadOutdatedInstanceKeys() ([]InstanceKey, error) {
@@ -503,8 +862,18 @@ func WriteInstance(instance *Instance, lastError error) error {
 				slave_lag_seconds,
 				num_slave_hosts,
 				slave_hosts,
-				cluster_name
-			) values (?, ?, NOW(), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				cluster_name,
+				data_center,
+				physical_environment,
+				uses_ssl,
+				master_ssl_allowed,
+				last_io_errno,
+				last_io_error,
+				last_io_error_timestamp,
+				last_sql_errno,
+				last_sql_error,
+				last_sql_error_timestamp
+			) values (?, ?, NOW(), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			instance.Key.Hostname, 
 		 	instance.Key.Port,
 		 	instance.ServerID,
@@ -527,6 +896,16 @@ func WriteInstance(instance *Instance, lastError error) error {
 		 	len(instance.SlaveHosts),
 		 	instance.GetSlaveHostsAsJson(),
 		 	instance.ClusterName,
+		 	instance.DataCenter,
+		 	instance.PhysicalEnvironment,
+		 	instance.UsesSSL,
+		 	instance.MasterSSLAllowed,
+		 	instance.LastIOErrno,
+		 	instance.LastIOError,
+		 	instance.LastIOErrorTimestamp,
+		 	instance.LastSQLErrno,
+		 	instance.LastSQLError,
+		 	instance.LastSQLErrorTimestamp,
 		 	)
     if err != nil {return log.Errore(err)}
 	
@@ -540,9 +919,10 @@ func WriteInstance(instance *Instance, lastError error) error {
 }
 
 
-// UpdateInstanceLastChecked updates the last_check timestamp in the orchestrator backed database 
+// UpdateInstanceLastChecked updates the last_check timestamp in the orchestrator backed database,
+// along with an indication of whether the instance could not be reached at all
 // for a given instance
-func UpdateInstanceLastChecked(instanceKey *InstanceKey) error {
+func UpdateInstanceLastChecked(instanceKey *InstanceKey, isUnreachable bool) error {
 	db,	err	:=	db.OpenOrchestrator()
 	if err != nil {return log.Errore(err)}
 	
@@ -550,10 +930,12 @@ func UpdateInstanceLastChecked(instanceKey *InstanceKey) error {
         	update 
         		database_instance 
         	set
-        		last_checked = NOW()
+        		last_checked = NOW(),
+        		is_unreachable = ?
 			where 
 				hostname = ?
 				and port = ?`,
+			isUnreachable,
 			instanceKey.Hostname, 
 		 	instanceKey.Port,
 		 	)
@@ -577,6 +959,9 @@ func ForgetInstance(instanceKey *InstanceKey) error {
 			instanceKey.Hostname, 
 		 	instanceKey.Port,
 		 )
+	deleteInstanceTags(instanceKey)
+	ForgetDiscoveryTimings(instanceKey)
+	deleteDiscoveryTimings(instanceKey)
 	AuditOperation("forget", instanceKey, "")
 	return err		 
 }
@@ -724,8 +1109,9 @@ func ChangeMasterTo(instanceKey *InstanceKey, masterKey *InstanceKey, masterBinl
 		return instance, errors.New(fmt.Sprintf("Cannot change master on: %+v because slave is running", instanceKey))
 	}
 	
+	// Point the slave to the name by which the master is configured to be known to its slaves (e.g. a VIP), if any
 	_, err = ExecInstance(instanceKey, fmt.Sprintf("change master to master_host='%s', master_port=%d, master_log_file='%s', master_log_pos=%d", 
-		masterKey.Hostname, masterKey.Port, masterBinlogCoordinates.LogFile, masterBinlogCoordinates.LogPos))
+		UnresolveHostname(masterKey.Hostname), masterKey.Port, masterBinlogCoordinates.LogFile, masterBinlogCoordinates.LogPos))
 	if err != nil {return instance, log.Errore(err)}
 	log.Infof("Changed master on %+v to: %+v, %+v", instanceKey, masterKey, masterBinlogCoordinates) 
 	
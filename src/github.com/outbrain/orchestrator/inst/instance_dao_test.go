@@ -21,6 +21,8 @@ import (
 	"math/rand"
 	"time"
 	"fmt"
+	"os"
+	"path"
 	"github.com/outbrain/orchestrator/inst"
 	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/orchestrator/db"
@@ -59,10 +61,15 @@ func clearTestMaintenance() {
 	_, _ = db.ExecOrchestrator("update database_instance_maintenance set maintenance_active=null, end_timestamp=NOW() where owner = ?", "unittest")
 }
 
-// The test also assumes one backend MySQL server.
+// The test also assumes one backend MySQL server. With ORCHESTRATOR_TEST_BACKEND=sqlite the backend is
+// an SQLite data file in the temp dir instead.
 func (s *TestSuite) SetUpSuite(c *C) { 
 	config.Config.MySQLTopologyUser = "msandbox"
 	config.Config.MySQLTopologyPassword = "msandbox"
+	if os.Getenv("ORCHESTRATOR_TEST_BACKEND") == "sqlite" {
+		config.Config.BackendDB = "sqlite"
+		config.Config.SQLite3DataFile = path.Join(os.TempDir(), "orchestrator_test.sqlite3")
+	}
 	config.Config.MySQLOrchestratorHost	= "127.0.0.1"
 	config.Config.MySQLOrchestratorPort	= 5532
 	config.Config.MySQLOrchestratorDatabase = "orchestrator"	
@@ -172,14 +179,14 @@ func (s *TestSuite) TestReadTopologyUnexisting(c *C) {
 func (s *TestSuite) TestMoveBelowAndBack(c *C) {
 	clearTestMaintenance()
 	// become child
-	slave1, err := inst.MoveBelow(&slave1Key, &slave2Key)
+	slave1, err := inst.MoveBelow(&slave1Key, &slave2Key, "test")
 	c.Assert(err, IsNil)
 	
 	c.Assert(slave1.MasterKey.Equals(&slave2Key), Equals, true)
 	c.Assert(slave1.SlaveRunning(), Equals, true)
 	
 	// And back; keep topology intact
-	slave1, _ = inst.MoveUp(&slave1Key)
+	slave1, _ = inst.MoveUp(&slave1Key, "test")
 	slave2, _ := inst.ReadTopologyInstance(&slave2Key)
 	
 	c.Assert(inst.InstancesAreSiblings(slave1, slave2), Equals, true)
@@ -191,7 +198,7 @@ func (s *TestSuite) TestMoveBelowAndBackComplex(c *C) {
 	clearTestMaintenance()
 	
 	// become child
-	slave1, _ := inst.MoveBelow(&slave1Key, &slave2Key)
+	slave1, _ := inst.MoveBelow(&slave1Key, &slave2Key, "test")
 	
 	c.Assert(slave1.MasterKey.Equals(&slave2Key), Equals, true)
 	c.Assert(slave1.SlaveRunning(), Equals, true)
@@ -209,7 +216,7 @@ func (s *TestSuite) TestMoveBelowAndBackComplex(c *C) {
 	c.Assert(err, IsNil)
 
 	// And back; keep topology intact
-	slave1, err = inst.MoveUp(&slave1Key)
+	slave1, err = inst.MoveUp(&slave1Key, "test")
 	c.Assert(err, IsNil)
 	_, err = inst.MasterPosWait(&slave1Key, &master.SelfBinlogCoordinates)
 	c.Assert(err, IsNil)
@@ -231,7 +238,7 @@ func (s *TestSuite) TestMoveBelowAndBackComplex(c *C) {
 func (s *TestSuite) TestFailMoveBelow(c *C) {	
 	clearTestMaintenance()
 	_, _ = inst.ExecInstance(&slave2Key, `set global binlog_format:='ROW'`)
-	_, err := inst.MoveBelow(&slave1Key, &slave2Key)
+	_, err := inst.MoveBelow(&slave1Key, &slave2Key, "test")
 	_, _ = inst.ExecInstance(&slave2Key, `set global binlog_format:='STATEMENT'`)
 	c.Assert(err, Not(IsNil))
 }
@@ -267,7 +274,7 @@ func (s *TestSuite) TestForgetMaster(c *C) {
 func (s *TestSuite) TestCluster(c *C) {
 	inst.ReadInstance(&masterKey)
 	orchestrator.StartDiscovery(slave1Key)
-	instances, _ := inst.ReadClusterInstances(fmt.Sprintf("%s:%d", masterKey.Hostname, masterKey.Port))
+	instances, _ := inst.ReadClusterInstances(fmt.Sprintf("%s:%d", masterKey.Hostname, masterKey.Port), "")
 	c.Assert(len(instances) >= 1, Equals, true)
 }
 
@@ -317,7 +324,7 @@ func (s *TestSuite) TestFailMoveBelowUponMaintenance(c *C) {
 	k, err := inst.BeginMaintenance(&slave1Key, "unittest", "TestBeginEndMaintenance");
 	c.Assert(err, IsNil)
 
-	_, err = inst.MoveBelow(&slave1Key, &slave2Key)
+	_, err = inst.MoveBelow(&slave1Key, &slave2Key, "test")
 	c.Assert(err, Not(IsNil))
 
 	err = inst.EndMaintenance(k);
@@ -333,7 +340,7 @@ func (s *TestSuite) TestFailMoveBelowUponSlaveStopped(c *C) {
 	slave1, _ = inst.StopSlaveNicely(&slave1.Key)
 	c.Assert(slave1.SlaveRunning(), Equals, false)
 
-	_, err := inst.MoveBelow(&slave1Key, &slave2Key)
+	_, err := inst.MoveBelow(&slave1Key, &slave2Key, "test")
 	c.Assert(err, Not(IsNil))
 
 	_, _ = inst.StartSlave(&slave1.Key)
@@ -347,9 +354,33 @@ func (s *TestSuite) TestFailMoveBelowUponOtherSlaveStopped(c *C) {
 	slave1, _ = inst.StopSlaveNicely(&slave1.Key)
 	c.Assert(slave1.SlaveRunning(), Equals, false)
 
-	_, err := inst.MoveBelow(&slave2Key, &slave1Key)
+	_, err := inst.MoveBelow(&slave2Key, &slave1Key, "test")
 	c.Assert(err, Not(IsNil))
 
 	_, _ = inst.StartSlave(&slave1.Key)
 }
 
+
+
+func (s *TestSuite) TestReadAuditPaging(c *C) {
+	owner := fmt.Sprintf("unittest-%d", rand.Int())
+	for i := 0; i < 3; i++ {
+		err := inst.AuditOwnedOperation("unittest", &masterKey, owner, fmt.Sprintf("entry %d", i))
+		c.Assert(err, IsNil)
+	}
+	defer func(pageSize int) { config.Config.AuditPageSize = pageSize }(config.Config.AuditPageSize)
+	config.Config.AuditPageSize = 2
+
+	filter := &inst.AuditFilter{InstanceKey: masterKey, Owner: owner}
+	audits, err := inst.ReadAudit(filter)
+	c.Assert(err, IsNil)
+	c.Assert(len(audits), Equals, 2)
+	c.Assert(audits[0].Message, Equals, "entry 2")
+	c.Assert(audits[0].Owner, Equals, owner)
+
+	filter.BeforeAuditId = audits[1].AuditId
+	audits, err = inst.ReadAudit(filter)
+	c.Assert(err, IsNil)
+	c.Assert(len(audits), Equals, 1)
+	c.Assert(audits[0].Message, Equals, "entry 0")
+}
@@ -0,0 +1,86 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+)
+
+// InstanceEventType is the type of a significant change in an instance's configuration or status
+type InstanceEventType string
+
+const (
+	MasterChangedEvent			InstanceEventType = "master-changed"
+	ReplicationStoppedEvent		InstanceEventType = "replication-stopped"
+	ReplicationStartedEvent		InstanceEventType = "replication-started"
+	VersionUpgradedEvent		InstanceEventType = "version-upgraded"
+	VersionChangedEvent			InstanceEventType = "version-changed"
+	ServerIdChangedEvent		InstanceEventType = "server-id-changed"
+	BinlogFormatChangedEvent	InstanceEventType = "binlog-format-changed"
+	InstanceUnreachableEvent	InstanceEventType = "instance-unreachable"
+)
+
+// InstanceEvent is a single detected change on an instance (namely in the database)
+type InstanceEvent struct {
+	EventId			int64
+	EventTimestamp	string
+	Key				InstanceKey
+	EventType		InstanceEventType
+	OldValue		string
+	NewValue		string
+}
+
+// NewInstanceEvent creates a new event of given type on given instance
+func NewInstanceEvent(instanceKey *InstanceKey, eventType InstanceEventType, oldValue string, newValue string) InstanceEvent {
+	return InstanceEvent{Key: *instanceKey, EventType: eventType, OldValue: oldValue, NewValue: newValue}
+}
+
+// DetectInstanceEvents compares a previously known state of an instance with its current state,
+// and returns the list of significant changes.
+func DetectInstanceEvents(previous *Instance, current *Instance) []InstanceEvent {
+	events := []InstanceEvent{}
+	if !previous.MasterKey.Equals(&current.MasterKey) {
+		events = append(events, NewInstanceEvent(&current.Key, MasterChangedEvent, previous.MasterKey.DisplayString(), current.MasterKey.DisplayString()))
+	}
+	if previous.IsSlave() && current.IsSlave() {
+		wasReplicating := previous.Slave_SQL_Running && previous.Slave_IO_Running
+		isReplicating := current.Slave_SQL_Running && current.Slave_IO_Running
+		replicationStatus := func(instance *Instance) string {
+			return fmt.Sprintf("sql_thread: %t, io_thread: %t", instance.Slave_SQL_Running, instance.Slave_IO_Running)
+		}
+		if wasReplicating && !isReplicating {
+			events = append(events, NewInstanceEvent(&current.Key, ReplicationStoppedEvent, replicationStatus(previous), replicationStatus(current)))
+		}
+		if !wasReplicating && isReplicating {
+			events = append(events, NewInstanceEvent(&current.Key, ReplicationStartedEvent, replicationStatus(previous), replicationStatus(current)))
+		}
+	}
+	if previous.Version != current.Version {
+		eventType := VersionChangedEvent
+		if previous.IsSmallerVersion(current) {
+			eventType = VersionUpgradedEvent
+		}
+		events = append(events, NewInstanceEvent(&current.Key, eventType, previous.Version, current.Version))
+	}
+	if previous.ServerID != current.ServerID {
+		events = append(events, NewInstanceEvent(&current.Key, ServerIdChangedEvent, fmt.Sprintf("%d", previous.ServerID), fmt.Sprintf("%d", current.ServerID)))
+	}
+	if previous.Binlog_format != current.Binlog_format {
+		events = append(events, NewInstanceEvent(&current.Key, BinlogFormatChangedEvent, previous.Binlog_format, current.Binlog_format))
+	}
+	return events
+}
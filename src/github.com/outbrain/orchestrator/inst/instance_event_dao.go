@@ -0,0 +1,139 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// WriteInstanceEvents stores given events in the orchestrator backend
+func WriteInstanceEvents(events []InstanceEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	for _, event := range events {
+		_, err = sqlutils.Exec(db, `
+				insert
+					into database_instance_event (
+						event_timestamp, hostname, port, event_type, old_value, new_value
+					) VALUES (
+						NOW(), ?, ?, ?, ?, ?
+					)
+				`,
+				event.Key.Hostname,
+			 	event.Key.Port,
+			 	string(event.EventType),
+			 	event.OldValue,
+			 	event.NewValue,
+			 )
+		if err != nil {return log.Errore(err)}
+		log.Infof("Instance event on %+v: %s (%s => %s)", event.Key, event.EventType, event.OldValue, event.NewValue)
+	}
+	return nil
+}
+
+// RecordInstanceEvents compares a freshly read instance with its state as stored in the backend,
+// and stores any significant changes as events. This is expected to be called before the instance is written.
+func RecordInstanceEvents(instance *Instance) error {
+	previous, found, err := ReadInstance(&instance.Key)
+	if err != nil || !found {
+		// New instance, nothing to compare with
+		return nil
+	}
+	return WriteInstanceEvents(DetectInstanceEvents(previous, instance))
+}
+
+// RecordInstanceUnreachable stores an unreachable event for given instance, if it has been reachable
+// up till now. Subsequent failed checks do not produce further events.
+func RecordInstanceUnreachable(instanceKey *InstanceKey) error {
+	previous, found, err := ReadInstance(instanceKey)
+	if err != nil || !found {
+		return nil
+	}
+	if !previous.IsLastCheckValid {
+		// Already known to be unreachable
+		return nil
+	}
+	return WriteInstanceEvents([]InstanceEvent{NewInstanceEvent(instanceKey, InstanceUnreachableEvent, "", "")})
+}
+
+// readInstanceEvents reads a page of events, optionally limited to a single instance
+func readInstanceEvents(instanceKey *InstanceKey, page int) ([]InstanceEvent, error) {
+	res := []InstanceEvent{}
+	whereCondition := ""
+	args := []interface{}{}
+	if instanceKey != nil {
+		whereCondition = "where hostname = ? and port = ?"
+		args = append(args, instanceKey.Hostname, instanceKey.Port)
+	}
+	args = append(args, config.Config.InstanceEventsPageSize, page * config.Config.InstanceEventsPageSize)
+	query := `
+		select
+			event_id,
+			event_timestamp,
+			hostname,
+			port,
+			event_type,
+			old_value,
+			new_value
+		from
+			database_instance_event
+		` + whereCondition + `
+		order by
+			event_id desc
+		limit ?
+		offset ?
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	event := InstanceEvent{}
+    	event.EventId = m.GetInt64("event_id")
+    	event.EventTimestamp = m.GetString("event_timestamp")
+    	event.Key.Hostname = m.GetString("hostname")
+    	event.Key.Port = m.GetInt("port")
+    	event.EventType = InstanceEventType(m.GetString("event_type"))
+    	event.OldValue = m.GetString("old_value")
+    	event.NewValue = m.GetString("new_value")
+
+    	res = append(res, event)
+    	return nil
+   	}, args...)
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// ReadRecentInstanceEvents returns a list of events ordered chronologically descending, using page number.
+func ReadRecentInstanceEvents(page int) ([]InstanceEvent, error) {
+	return readInstanceEvents(nil, page)
+}
+
+// ReadInstanceEvents returns a list of events of given instance, ordered chronologically descending, using page number.
+func ReadInstanceEvents(instanceKey *InstanceKey, page int) ([]InstanceEvent, error) {
+	return readInstanceEvents(instanceKey, page)
+}
@@ -19,6 +19,7 @@ package inst
 import (
 	"testing"
 	"github.com/outbrain/orchestrator/inst"
+	"github.com/outbrain/orchestrator/config"
 	. "gopkg.in/check.v1"
 )
 
@@ -135,3 +136,219 @@ func (s *TestSuite) TestParseInstanceKey(c *C) {
 }
 
 
+func (s *TestSuite) TestResolveHostnameAliasFromConfig(c *C) {
+	config.Config.HostnameAliases["db-vip.example.com"] = "sql00.db"
+	defer delete(config.Config.HostnameAliases, "db-vip.example.com")
+	config.Config.HostnameUnresolves["sql00.db"] = "db-vip.example.com"
+	defer delete(config.Config.HostnameUnresolves, "sql00.db")
+
+	c.Assert(inst.ResolveHostnameAlias("db-vip.example.com"), Equals, "sql00.db")
+	c.Assert(inst.UnresolveHostname("sql00.db"), Equals, "db-vip.example.com")
+	c.Assert(inst.UnresolveHostname("sql01.db"), Equals, "sql01.db")
+
+	masterKey := inst.ResolveInstanceKeyAlias(&inst.InstanceKey{Hostname: "db-vip.example.com", Port: 3306})
+	c.Assert(*masterKey, Equals, inst.InstanceKey{Hostname: "sql00.db", Port: 3306})
+}
+
+
+func (s *TestSuite) TestDiscoveryIgnoreFilters(c *C) {
+	config.Config.DiscoveryIgnoreHostnameFilters = []string{"^sandbox[0-9]+[.]"}
+	config.Config.DiscoveryIgnoreMasterHostnameFilters = []string{"[.]test[.]db$"}
+	c.Assert(config.Config.CompileDiscoveryFilters(), IsNil)
+	defer func() {
+		config.Config.DiscoveryIgnoreHostnameFilters = []string{}
+		config.Config.DiscoveryIgnoreMasterHostnameFilters = []string{}
+		config.Config.CompileDiscoveryFilters()
+	}()
+
+	sandboxKey := inst.InstanceKey{Hostname: "sandbox7.db", Port: 3306}
+	prodKey := inst.InstanceKey{Hostname: "sql00.db", Port: 3306}
+	testMasterKey := inst.InstanceKey{Hostname: "sql01.test.db", Port: 3306}
+
+	c.Assert(inst.IsDiscoveryIgnoredInstance(&sandboxKey), Equals, true)
+	c.Assert(inst.IsDiscoveryIgnoredInstance(&prodKey), Equals, false)
+	c.Assert(inst.IsDiscoveryIgnoredMaster(&prodKey, &testMasterKey), Equals, true)
+	c.Assert(inst.IsDiscoveryIgnoredMaster(&sandboxKey, &prodKey), Equals, false)
+
+	hitsCount := 0
+	for _, hit := range inst.ReadDiscoveryFilterHits() {
+		if hit.Key == sandboxKey || hit.Key == prodKey {
+			hitsCount++
+		}
+	}
+	c.Assert(hitsCount, Equals, 2)
+}
+
+
+func (s *TestSuite) TestGroupInstancesByDataCenter(c *C) {
+	i0 := inst.Instance {Key: inst.InstanceKey{Hostname: "sql00.ny.db", Port: 3306}, DataCenter: "ny"}
+	i1 := inst.Instance {Key: inst.InstanceKey{Hostname: "sql01.ny.db", Port: 3306}, DataCenter: "ny"}
+	i2 := inst.Instance {Key: inst.InstanceKey{Hostname: "sql00.la.db", Port: 3306}, DataCenter: "la"}
+	instances := [](*inst.Instance){&i0, &i1, &i2}
+
+	c.Assert(len(inst.FilterInstancesByDataCenter(instances, "ny")), Equals, 2)
+	c.Assert(len(inst.FilterInstancesByDataCenter(instances, "sf")), Equals, 0)
+
+	grouped := inst.GroupInstancesByDataCenter(instances)
+	c.Assert(len(grouped), Equals, 2)
+	c.Assert(len(grouped["la"]), Equals, 1)
+	c.Assert(i2.HumanReadableDescription(), Equals, "sql00.la.db:3306 [la]")
+}
+
+
+func (s *TestSuite) TestParseTag(c *C) {
+	tag, err := inst.ParseTag("role=reporting")
+	c.Assert(err, IsNil)
+	c.Assert(tag.TagName, Equals, "role")
+	c.Assert(tag.TagValue, Equals, "reporting")
+
+	tag, err = inst.ParseTag("candidate")
+	c.Assert(err, IsNil)
+	c.Assert(tag.TagName, Equals, "candidate")
+	c.Assert(tag.TagValue, Equals, "")
+
+	_, err = inst.ParseTag("=no")
+	c.Assert(err, Not(IsNil))
+}
+
+
+func (s *TestSuite) TestParseTagSelectors(c *C) {
+	selectors, err := inst.ParseTagSelectors("role=reporting, team, !candidate")
+	c.Assert(err, IsNil)
+	c.Assert(len(selectors), Equals, 3)
+	c.Assert(selectors[0], Equals, inst.TagSelector{TagName: "role", TagValue: "reporting", HasValue: true})
+	c.Assert(selectors[1], Equals, inst.TagSelector{TagName: "team"})
+	c.Assert(selectors[2], Equals, inst.TagSelector{TagName: "candidate", Negate: true})
+
+	_, err = inst.ParseTagSelectors("!candidate=no")
+	c.Assert(err, Not(IsNil))
+	_, err = inst.ParseTagSelectors("")
+	c.Assert(err, Not(IsNil))
+}
+
+
+func (s *TestSuite) TestSortPromotionCandidates(c *C) {
+	i0 := inst.Instance {Key: inst.InstanceKey{Hostname: "sql00.db", Port: 3306}, ExecBinlogCoordinates: inst.BinlogCoordinates{LogFile: "mysql-bin.00017", LogPos: 104}}
+	i1 := inst.Instance {Key: inst.InstanceKey{Hostname: "sql01.db", Port: 3306}, ExecBinlogCoordinates: inst.BinlogCoordinates{LogFile: "mysql-bin.00017", LogPos: 5000}}
+	i2 := inst.Instance {Key: inst.InstanceKey{Hostname: "sql02.db", Port: 3306}, ExecBinlogCoordinates: inst.BinlogCoordinates{LogFile: "mysql-bin.00017", LogPos: 104}}
+	i3 := inst.Instance {Key: inst.InstanceKey{Hostname: "sql03.db", Port: 3306}, ExecBinlogCoordinates: inst.BinlogCoordinates{LogFile: "mysql-bin.00018", LogPos: 104}}
+	promotionRules := map[inst.InstanceKey]inst.CandidatePromotionRule{
+		i2.Key: inst.PreferPromoteRule,
+		i3.Key: inst.MustNotPromoteRule,
+	}
+
+	candidates := inst.SortPromotionCandidates([](*inst.Instance){&i0, &i1, &i2, &i3}, promotionRules)
+	c.Assert(len(candidates), Equals, 3)
+	c.Assert(candidates[0].Key, Equals, i2.Key)
+	c.Assert(candidates[1].Key, Equals, i1.Key)
+	c.Assert(candidates[2].Key, Equals, i0.Key)
+
+	_, err := inst.ParseCandidatePromotionRule("maybe")
+	c.Assert(err, Not(IsNil))
+}
+
+
+func (s *TestSuite) TestIsSmallerVersion(c *C) {
+	i559 	:= inst.Instance {Version: "5.5.9"}
+	i5536 	:= inst.Instance {Version: "5.5.36-log"}
+	i56 	:= inst.Instance {Version: "5.6.17"}
+
+	c.Assert(i559.IsSmallerVersion(&i5536), Equals, true)
+	c.Assert(i5536.IsSmallerVersion(&i559), Equals, false)
+	c.Assert(i5536.IsSmallerVersion(&i56), Equals, true)
+	c.Assert(i56.IsSmallerVersion(&i56), Equals, false)
+}
+
+
+func (s *TestSuite) TestDetectInstanceEvents(c *C) {
+	previous := inst.Instance {
+		Key: inst.InstanceKey{Hostname: "sql01.db", Port: 3306},
+		MasterKey: inst.InstanceKey{Hostname: "sql00.db", Port: 3306},
+		ReadBinlogCoordinates: inst.BinlogCoordinates{LogFile: "mysql-bin.00017", LogPos: 104},
+		Slave_SQL_Running: true,
+		Slave_IO_Running: true,
+		Version: "5.5.36",
+		ServerID: 1,
+		Binlog_format: "STATEMENT",
+	}
+	current := previous
+	c.Assert(len(inst.DetectInstanceEvents(&previous, &current)), Equals, 0)
+
+	current.Slave_SQL_Running = false
+	current.Version = "5.6.17"
+	events := inst.DetectInstanceEvents(&previous, &current)
+	c.Assert(len(events), Equals, 2)
+	c.Assert(events[0].EventType, Equals, inst.ReplicationStoppedEvent)
+	c.Assert(events[1].EventType, Equals, inst.VersionUpgradedEvent)
+	c.Assert(events[1].NewValue, Equals, "5.6.17")
+
+	current = previous
+	current.MasterKey.Hostname = "sql02.db"
+	current.ServerID = 2
+	events = inst.DetectInstanceEvents(&previous, &current)
+	c.Assert(len(events), Equals, 2)
+	c.Assert(events[0].EventType, Equals, inst.MasterChangedEvent)
+	c.Assert(events[0].OldValue, Equals, "sql00.db:3306")
+	c.Assert(events[1].EventType, Equals, inst.ServerIdChangedEvent)
+}
+
+
+func (s *TestSuite) TestDiscoveryTimings(c *C) {
+	samplesPerInstance := config.Config.DiscoveryTimingSamplesPerInstance
+	defer func() { config.Config.DiscoveryTimingSamplesPerInstance = samplesPerInstance }()
+	config.Config.DiscoveryTimingSamplesPerInstance = 3
+	fastKey := inst.InstanceKey{Hostname: "fast.db", Port: 3306}
+	slowKey := inst.InstanceKey{Hostname: "slow.db", Port: 3306}
+	for i := 1; i <= 4; i++ {
+		inst.RecordDiscoveryTiming(&inst.DiscoveryTiming{Key: fastKey, PhaseMillis: map[inst.DiscoveryPhase]float64{inst.ConnectPhase: float64(i)}, TotalMillis: float64(i)})
+		inst.RecordDiscoveryTiming(&inst.DiscoveryTiming{Key: slowKey, PhaseMillis: map[inst.DiscoveryPhase]float64{inst.ConnectPhase: float64(100 * i)}, TotalMillis: float64(100 * i)})
+	}
+	defer inst.ForgetDiscoveryTimings(&fastKey)
+	defer inst.ForgetDiscoveryTimings(&slowKey)
+
+	timings := inst.ReadDiscoveryTimings(&fastKey)
+	c.Assert(len(timings), Equals, 3)
+	c.Assert(timings[0].TotalMillis, Equals, 4.0)
+
+	slowest := inst.ReadSlowestDiscoveryInstances(1)
+	c.Assert(len(slowest), Equals, 1)
+	c.Assert(slowest[0].Key, Equals, slowKey)
+	c.Assert(slowest[0].AverageMillis, Equals, 300.0)
+
+	for _, p := range inst.ReadDiscoveryTimingPercentiles() {
+		if p.Phase == inst.TotalPhase && p.Percentile == 50 {
+			c.Assert(p.Millis, Equals, 4.0)
+		}
+		if p.Phase == inst.TotalPhase && p.Percentile == 99 {
+			c.Assert(p.Millis, Equals, 400.0)
+		}
+	}
+}
+
+
+func (s *TestSuite) TestComputeClusterNames(c *C) {
+	master := inst.InstanceKey{Hostname: "master.db", Port: 3306}
+	slave := inst.InstanceKey{Hostname: "slave.db", Port: 3306}
+	subSlave := inst.InstanceKey{Hostname: "sub.slave.db", Port: 3306}
+	orphan := inst.InstanceKey{Hostname: "orphan.db", Port: 3306}
+	coMaster1 := inst.InstanceKey{Hostname: "comaster1.db", Port: 3306}
+	coMaster2 := inst.InstanceKey{Hostname: "comaster2.db", Port: 3306}
+	coSlave := inst.InstanceKey{Hostname: "coslave.db", Port: 3306}
+
+	clusterNames := inst.ComputeClusterNames(map[inst.InstanceKey]inst.InstanceKey{
+		master: inst.InstanceKey{},
+		slave: master,
+		subSlave: slave,
+		orphan: inst.InstanceKey{Hostname: "gone.db", Port: 3306},
+		coMaster1: coMaster2,
+		coMaster2: coMaster1,
+		coSlave: coMaster2,
+	})
+	c.Assert(clusterNames[master], Equals, "master.db:3306")
+	c.Assert(clusterNames[slave], Equals, "master.db:3306")
+	c.Assert(clusterNames[subSlave], Equals, "master.db:3306")
+	c.Assert(clusterNames[orphan], Equals, "orphan.db:3306")
+	c.Assert(clusterNames[coMaster1], Equals, "comaster1.db:3306")
+	c.Assert(clusterNames[coMaster2], Equals, "comaster1.db:3306")
+	c.Assert(clusterNames[coSlave], Equals, "comaster1.db:3306")
+}
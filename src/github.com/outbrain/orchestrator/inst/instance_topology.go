@@ -48,8 +48,8 @@ func InstancesAreSiblings(instance0, instance1 *Instance) bool {
 
 // MoveUp will attempt moving instance indicated by instanceKey up the topology hierarchy.
 // It will perform all safety and sanity checks and will tamper with this instance's replication 
-// as well as its master.
-func MoveUp(instanceKey *InstanceKey) (*Instance, error) {
+// as well as its master. The move is audited on behalf of given owner.
+func MoveUp(instanceKey *InstanceKey, owner string) (*Instance, error) {
 	instance, err := ReadTopologyInstance(instanceKey)
 	if err != nil {	return instance, err}
 	if !instance.IsSlave() {
@@ -100,9 +100,11 @@ func MoveUp(instanceKey *InstanceKey) (*Instance, error) {
 	Cleanup:
 	instance, _ = StartSlave(instanceKey)
 	master, _ = StartSlave(&master.Key)
+	// Topology may have changed (even on error); have the entire subtree reflect it
+	RecomputeClusterNames()
 	if err != nil {	return instance, log.Errore(err)}
 	// and we're done (pending deferred functions)
-	AuditOperation("move-up", instanceKey, fmt.Sprintf("moved up %+v. Previous master: %+v", *instanceKey, master.Key))
+	AuditOwnedOperation("move-up", instanceKey, owner, fmt.Sprintf("moved up %+v. Previous master: %+v", *instanceKey, master.Key))
 	 
 	return instance, err
 }
@@ -110,8 +112,8 @@ func MoveUp(instanceKey *InstanceKey) (*Instance, error) {
 
 // MoveUp will attempt moving instance indicated by instanceKey below its supposed sibling indicated by sinblingKey.
 // It will perform all safety and sanity checks and will tamper with this instance's replication 
-// as well as its sibling.
-func MoveBelow(instanceKey, siblingKey *InstanceKey) (*Instance, error) {
+// as well as its sibling. The move is audited on behalf of given owner.
+func MoveBelow(instanceKey, siblingKey *InstanceKey, owner string) (*Instance, error) {
 	instance, err := ReadTopologyInstance(instanceKey)
 	if err != nil {	return instance, err}
 	sibling, err := ReadTopologyInstance(siblingKey)
@@ -169,14 +171,39 @@ func MoveBelow(instanceKey, siblingKey *InstanceKey) (*Instance, error) {
 	Cleanup:
 	instance, _ = StartSlave(instanceKey)
 	sibling, _ = StartSlave(siblingKey)
+	// Topology may have changed (even on error); have the entire subtree reflect it
+	RecomputeClusterNames()
 	if err != nil {	return instance, log.Errore(err)}
 	// and we're done (pending deferred functions)
-	AuditOperation("move-below", instanceKey, fmt.Sprintf("moved %+v below %+v", *instanceKey, *siblingKey))	
+	AuditOwnedOperation("move-below", instanceKey, owner, fmt.Sprintf("moved %+v below %+v", *instanceKey, *siblingKey))	
 	 
 	return instance, err
 }
 
 
+// MoveUpSlaves will attempt moving up (see MoveUp) each of the slaves of given instance which satisfy given
+// tag selectors (may be empty). It returns the slaves moved up; failure to move a slave does not stop
+// the others from being moved, and the last such error is returned.
+func MoveUpSlaves(instanceKey *InstanceKey, tagSelectors string, owner string) ([](*Instance), error) {
+	res := [](*Instance){}
+	slaves, err := ReadSlaveInstances(instanceKey)
+	if err != nil {return res, err}
+	slaves, err = FilterInstancesByTags(slaves, tagSelectors)
+	if err != nil {return res, err}
+
+	var lastErr error
+	for _, slave := range slaves {
+		slave, err := MoveUp(&slave.Key, owner)
+		if err != nil {
+			lastErr = log.Errore(err)
+			continue
+		}
+		res = append(res, slave)
+	}
+	return res, lastErr
+}
+
+
 // getAsciiTopologyEntry will get an ascii topology tree rooted at given instance. Ir recursively
 // draws the tree 
 func getAsciiTopologyEntry(depth int, instance *Instance, replicationMap map[*Instance]([]*Instance)) []string {
@@ -189,7 +216,7 @@ func getAsciiTopologyEntry(depth int, instance *Instance, replicationMap map[*In
 			prefix += "- "
 		}
 	}
-	entry := fmt.Sprintf("%s%s", prefix, instance.Key.DisplayString()) 
+	entry := fmt.Sprintf("%s%s", prefix, instance.HumanReadableDescription()) 
 	result := []string{entry}
 	for _, slave := range replicationMap[instance] {
 		slavesResult := getAsciiTopologyEntry(depth + 1, slave, replicationMap)
@@ -200,7 +227,7 @@ func getAsciiTopologyEntry(depth int, instance *Instance, replicationMap map[*In
 
 // AsciiTopology returns a string representation of the topology of given clusterName.
 func AsciiTopology(clusterName string) (string, error) {
-	instances, err := ReadClusterInstances(clusterName)
+	instances, err := ReadClusterInstances(clusterName, "")
 	if err != nil {return "", err} 
 
 	instancesMap := make(map[InstanceKey](*Instance))
@@ -213,7 +240,7 @@ func AsciiTopology(clusterName string) (string, error) {
 	var masterInstance *Instance
 	// Investigate slaves:
 	for _, instance := range instances {
-		master, ok := instancesMap[instance.MasterKey]
+		master, ok := instancesMap[*ResolveInstanceKeyAlias(&instance.MasterKey)]
 		if ok {
 			if _, ok := replicationMap[master]; !ok {
 				replicationMap[master] = [](*Instance){}
@@ -0,0 +1,116 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// SnapshotTopologies records the current master/slave edges and key status of all known instances
+// in the topology history table.
+func SnapshotTopologies() error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			insert ignore
+				into database_instance_topology_history (
+					snapshot_timestamp, hostname, port, last_checked, last_seen,
+					server_id, version, binlog_format, log_bin, log_slave_updates,
+					master_host, master_port, slave_sql_running, slave_io_running,
+					seconds_behind_master, slave_lag_seconds, slave_hosts, cluster_name,
+					data_center, physical_environment
+				)
+			select
+				NOW(), hostname, port, last_checked, last_seen,
+				server_id, version, binlog_format, log_bin, log_slave_updates,
+				master_host, master_port, slave_sql_running, slave_io_running,
+				seconds_behind_master, slave_lag_seconds, slave_hosts, cluster_name,
+				data_center, physical_environment
+			from
+				database_instance
+			`,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	return nil
+}
+
+// ExpireTopologyHistory purges topology snapshots older than TopologySnapshotRetentionDays
+func ExpireTopologyHistory() error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			delete
+				from database_instance_topology_history
+			where
+				snapshot_timestamp < NOW() - interval ? day
+			`,
+			config.Config.TopologySnapshotRetentionDays,
+		 )
+	return err
+}
+
+// ReadHistoryClusterInstances reads the instances of given cluster (by name or by alias) as recorded by
+// the latest topology snapshot taken at or before given timestamp (formatted as 'YYYY-MM-DD HH:MM:SS').
+// Instance status is relative to the snapshot time.
+func ReadHistoryClusterInstances(clusterName string, historyTimestamp string) ([](*Instance), error) {
+	instances := [](*Instance){}
+
+	clusterName, err := ReadClusterNameByAlias(clusterName)
+	if	err	!=	nil	{
+		return instances, err
+	}
+	db,	err	:=	db.OpenOrchestrator()
+	if	err	!=	nil	{
+		return instances, log.Errore(err)
+	}
+
+	query := `
+		select
+			*,
+			timestampdiff(second, last_checked, snapshot_timestamp) as seconds_since_last_checked,
+			(last_checked <= last_seen) is true as is_last_check_valid,
+			timestampdiff(second, last_seen, snapshot_timestamp) as seconds_since_last_seen
+		from
+			database_instance_topology_history
+		where
+			snapshot_timestamp = (
+				select
+					max(snapshot_timestamp)
+				from
+					database_instance_topology_history
+				where
+					snapshot_timestamp <= ?
+					and cluster_name = ?
+			)
+			and cluster_name = ?
+		order by
+			hostname, port`
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		instance := readInstanceRow(m)
+    	instances = append(instances, instance)
+    	return nil
+   	}, historyTimestamp, clusterName, clusterName)
+
+	return instances, err
+}
@@ -0,0 +1,41 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+)
+
+// LagSample is a single poll's replication lag and position of a slave
+type LagSample struct {
+	Key						InstanceKey
+	SampleTimestamp			string
+	SecondsBehindMaster		sql.NullInt64
+	SlaveLagSeconds			sql.NullInt64
+	ReadBinlogCoordinates	BinlogCoordinates
+	ExecBinlogCoordinates	BinlogCoordinates
+}
+
+// ClusterLagSample aggregates the lag of a cluster's slaves over a time bucket
+type ClusterLagSample struct {
+	ClusterName				string
+	BucketTimestamp			string
+	CountInstances			int
+	MaxSecondsBehindMaster	sql.NullInt64
+	MaxSlaveLagSeconds		sql.NullInt64
+	AvgSlaveLagSeconds		sql.NullInt64
+}
@@ -0,0 +1,242 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// WriteLagSample appends the current lag and position of given slave to the lag history
+func WriteLagSample(instance *Instance) error {
+	if !instance.IsSlave() {
+		return nil
+	}
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			insert ignore
+				into database_instance_lag_history (
+					hostname, port, sample_timestamp, cluster_name,
+					seconds_behind_master, slave_lag_seconds,
+					master_log_file, read_master_log_pos, relay_master_log_file, exec_master_log_pos
+				) VALUES (
+					?, ?, NOW(), ?,
+					?, ?,
+					?, ?, ?, ?
+				)
+			`,
+			instance.Key.Hostname,
+			instance.Key.Port,
+			instance.ClusterName,
+			instance.SecondsBehindMaster,
+			instance.SlaveLagSeconds,
+			instance.ReadBinlogCoordinates.LogFile,
+			instance.ReadBinlogCoordinates.LogPos,
+			instance.ExecBinlogCoordinates.LogFile,
+			instance.ExecBinlogCoordinates.LogPos,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	return nil
+}
+
+// DownsampleLagHistory reduces lag samples older than LagHistoryDownsampleHours to a single sample
+// (the first) per instance per LagHistoryDownsampleMinutes. Repeated runs are idempotent.
+func DownsampleLagHistory() error {
+	if config.Config.LagHistoryDownsampleHours == 0 || config.Config.LagHistoryDownsampleMinutes == 0 {
+		return nil
+	}
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	bucketSeconds := config.Config.LagHistoryDownsampleMinutes * 60
+	if config.Config.IsSQLite() {
+		// SQLite has no multi-table delete; a sample is removed if an earlier one exists in its bucket
+		_, err = sqlutils.Exec(db, `
+				delete
+				from
+					database_instance_lag_history
+				where
+					sample_timestamp < NOW() - interval ? hour
+					and exists (
+						select
+							1
+						from
+							database_instance_lag_history kept_samples
+						where
+							kept_samples.hostname = database_instance_lag_history.hostname
+							and kept_samples.port = database_instance_lag_history.port
+							and floor(unix_timestamp(kept_samples.sample_timestamp) / ?) = floor(unix_timestamp(database_instance_lag_history.sample_timestamp) / ?)
+							and kept_samples.sample_timestamp < database_instance_lag_history.sample_timestamp
+					)
+				`,
+				config.Config.LagHistoryDownsampleHours,
+				bucketSeconds,
+				bucketSeconds,
+			 )
+		return err
+	}
+	_, err = sqlutils.Exec(db, `
+			delete
+				database_instance_lag_history
+			from
+				database_instance_lag_history
+				join (
+					select
+						hostname, port,
+						floor(unix_timestamp(sample_timestamp) / ?) as bucket,
+						min(sample_timestamp) as kept_sample_timestamp
+					from
+						database_instance_lag_history
+					where
+						sample_timestamp < NOW() - interval ? hour
+					group by
+						hostname, port, bucket
+				) kept_samples using (hostname, port)
+			where
+				database_instance_lag_history.sample_timestamp < NOW() - interval ? hour
+				and floor(unix_timestamp(database_instance_lag_history.sample_timestamp) / ?) = kept_samples.bucket
+				and database_instance_lag_history.sample_timestamp != kept_samples.kept_sample_timestamp
+			`,
+			bucketSeconds,
+			config.Config.LagHistoryDownsampleHours,
+			config.Config.LagHistoryDownsampleHours,
+			bucketSeconds,
+		 )
+	return err
+}
+
+// ExpireLagHistory purges lag samples older than LagHistoryRetentionDays
+func ExpireLagHistory() error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			delete
+				from database_instance_lag_history
+			where
+				sample_timestamp < NOW() - interval ? day
+			`,
+			config.Config.LagHistoryRetentionDays,
+		 )
+	return err
+}
+
+// ReadLagHistory returns lag samples of given instance within given time range (timestamps formatted as
+// 'YYYY-MM-DD HH:MM:SS'), oldest first. An empty `from` means an hour ago; an empty `to` means now.
+func ReadLagHistory(instanceKey *InstanceKey, from string, to string) ([]LagSample, error) {
+	res := []LagSample{}
+	query := `
+		select
+			hostname,
+			port,
+			sample_timestamp,
+			seconds_behind_master,
+			slave_lag_seconds,
+			master_log_file,
+			read_master_log_pos,
+			relay_master_log_file,
+			exec_master_log_pos
+		from
+			database_instance_lag_history
+		where
+			hostname = ?
+			and port = ?
+			and sample_timestamp >= ifnull(nullif(?, ''), NOW() - interval 1 hour)
+			and sample_timestamp <= ifnull(nullif(?, ''), NOW())
+		order by
+			sample_timestamp
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	sample := LagSample{}
+    	sample.Key.Hostname = m.GetString("hostname")
+    	sample.Key.Port = m.GetInt("port")
+    	sample.SampleTimestamp = m.GetString("sample_timestamp")
+    	sample.SecondsBehindMaster = m.GetNullInt64("seconds_behind_master")
+    	sample.SlaveLagSeconds = m.GetNullInt64("slave_lag_seconds")
+    	sample.ReadBinlogCoordinates.LogFile = m.GetString("master_log_file")
+    	sample.ReadBinlogCoordinates.LogPos = m.GetInt64("read_master_log_pos")
+    	sample.ExecBinlogCoordinates.LogFile = m.GetString("relay_master_log_file")
+    	sample.ExecBinlogCoordinates.LogPos = m.GetInt64("exec_master_log_pos")
+
+    	res = append(res, sample)
+    	return nil
+   	}, instanceKey.Hostname, instanceKey.Port, from, to)
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// ReadClusterLagHistory aggregates lag samples of all slaves in given cluster (by name or by alias) over time
+// buckets of given size, within given time range (see ReadLagHistory). Oldest bucket first.
+func ReadClusterLagHistory(clusterName string, from string, to string, bucketSeconds int) ([]ClusterLagSample, error) {
+	res := []ClusterLagSample{}
+	if bucketSeconds <= 0 {
+		bucketSeconds = 60
+	}
+	query := `
+		select
+			from_unixtime(floor(unix_timestamp(sample_timestamp) / ?) * ?) as bucket_timestamp,
+			count(distinct concat(hostname, ':', port)) as count_instances,
+			max(seconds_behind_master) as max_seconds_behind_master,
+			max(slave_lag_seconds) as max_slave_lag_seconds,
+			round(avg(slave_lag_seconds)) as avg_slave_lag_seconds
+		from
+			database_instance_lag_history
+		where
+			cluster_name = ?
+			and sample_timestamp >= ifnull(nullif(?, ''), NOW() - interval 1 hour)
+			and sample_timestamp <= ifnull(nullif(?, ''), NOW())
+		group by
+			bucket_timestamp
+		order by
+			bucket_timestamp
+		`
+	clusterName, err := ReadClusterNameByAlias(clusterName)
+	if err != nil {return res, err}
+
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	sample := ClusterLagSample{ClusterName: clusterName}
+    	sample.BucketTimestamp = m.GetString("bucket_timestamp")
+    	sample.CountInstances = m.GetInt("count_instances")
+    	sample.MaxSecondsBehindMaster = m.GetNullInt64("max_seconds_behind_master")
+    	sample.MaxSlaveLagSeconds = m.GetNullInt64("max_slave_lag_seconds")
+    	sample.AvgSlaveLagSeconds = m.GetNullInt64("avg_slave_lag_seconds")
+
+    	res = append(res, sample)
+    	return nil
+   	}, bucketSeconds, bucketSeconds, clusterName, from, to)
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
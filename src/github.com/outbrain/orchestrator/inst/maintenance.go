@@ -29,4 +29,7 @@ type Maintenance struct {
 	IsActive			bool
 	Owner				string
 	Reason				string
+	EndTimestamp		string	// For an active maintenance: its expiry
+	ProcessingNodeHostname	string
+	ProcessingNodeToken		string
 }
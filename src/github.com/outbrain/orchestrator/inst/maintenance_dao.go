@@ -19,13 +19,16 @@ package inst
 import (
 	"fmt"
 	"errors"
+	"time"
 	"github.com/outbrain/sqlutils"
 	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/process"
 	"github.com/outbrain/log"
 )
 
-// ReadActiveMaintenance returns the list of currently active maintenance entries
-func ReadActiveMaintenance() ([]Maintenance, error) {
+// readActiveMaintenance returns active maintenance entries matching given condition
+func readActiveMaintenance(condition string, args ...interface{}) ([]Maintenance, error) {
 	res := []Maintenance{}
 	query := fmt.Sprintf(`
 		select 
@@ -36,14 +39,18 @@ func ReadActiveMaintenance() ([]Maintenance, error) {
 			timestampdiff(second, begin_timestamp, now()) as seconds_elapsed,
 			maintenance_active,
 			owner,
-			reason
+			reason,
+			ifnull(end_timestamp, '') as end_timestamp,
+			processing_node_hostname,
+			processing_node_token
 		from 
 			database_instance_maintenance
 		where
 			maintenance_active = 1
+			%s
 		order by
 			database_instance_maintenance_id
-		`)
+		`, condition)
 	db,	err	:=	db.OpenOrchestrator()
     if err != nil {goto Cleanup}
     
@@ -57,10 +64,13 @@ func ReadActiveMaintenance() ([]Maintenance, error) {
     	maintenance.IsActive = m.GetBool("maintenance_active") 
     	maintenance.Owner = m.GetString("owner") 
     	maintenance.Reason = m.GetString("reason") 
+    	maintenance.EndTimestamp = m.GetString("end_timestamp") 
+    	maintenance.ProcessingNodeHostname = m.GetString("processing_node_hostname") 
+    	maintenance.ProcessingNodeToken = m.GetString("processing_node_token") 
 
     	res = append(res, maintenance)
     	return err       	
-   	})
+   	}, args...)
 	Cleanup:
 
 	if err	!=	nil	{
@@ -70,24 +80,50 @@ func ReadActiveMaintenance() ([]Maintenance, error) {
 
 }
 
-// BeginMaintenance will make new maintenance entry for given instanceKey.
+// ReadActiveMaintenance returns the list of currently active maintenance entries
+func ReadActiveMaintenance() ([]Maintenance, error) {
+	return readActiveMaintenance("")
+}
+
+// BeginMaintenance will make new maintenance entry for given instanceKey, owned by this process and expiring
+// after MaintenanceExpireMinutes. This is the kind of maintenance taken by topology operations.
 func BeginMaintenance(instanceKey *InstanceKey, owner string, reason string) (int64, error) {
-	db,	err	:=	db.OpenOrchestrator()
+	return BeginBoundedMaintenance(instanceKey, owner, reason, time.Duration(config.Config.MaintenanceExpireMinutes) * time.Minute, true)
+}
+
+// BeginBoundedMaintenance will make new maintenance entry for given instanceKey, expiring after given duration.
+// When bound to process, the entry is owned by this process: should the process go away, the entry
+// is ended (see ExpireMaintenance).
+func BeginBoundedMaintenance(instanceKey *InstanceKey, owner string, reason string, duration time.Duration, bindToProcess bool) (int64, error) {
 	var maintenanceToken int64 = 0
+	if duration <= 0 {
+		return maintenanceToken, errors.New(fmt.Sprintf("Invalid maintenance duration: %+v", duration))
+	}
+	db,	err	:=	db.OpenOrchestrator()
 	if err != nil {return maintenanceToken, log.Errore(err)}
+	processingNodeHostname, processingNodeToken := "", ""
+	if bindToProcess {
+		process.StartContinuousRegistration()
+		processingNodeHostname, processingNodeToken = process.ThisHostname, process.ProcessToken
+	}
 	
 	res, err := sqlutils.Exec(db, `
 			insert ignore
 				into database_instance_maintenance (
-					hostname, port, maintenance_active, begin_timestamp, end_timestamp, owner, reason
+					hostname, port, maintenance_active, begin_timestamp, end_timestamp, owner, reason,
+					processing_node_hostname, processing_node_token
 				) VALUES (
-					?, ?, 1, NOW(), NULL, ?, ?
+					?, ?, 1, NOW(), NOW() + interval ? second, ?, ?,
+					?, ?
 				)
 			`,
 			instanceKey.Hostname, 
 		 	instanceKey.Port,
+		 	int64(duration.Seconds()),
 		 	owner, 
 		 	reason,
+		 	processingNodeHostname,
+		 	processingNodeToken,
 		 )
 	if err != nil {return maintenanceToken, log.Errore(err)}	
 	
@@ -96,7 +132,7 @@ func BeginMaintenance(instanceKey *InstanceKey, owner string, reason string) (in
 	} else {
 		// success
 		maintenanceToken, _ = res.LastInsertId()
-		AuditOperation("begin-maintenance", instanceKey, fmt.Sprintf("maintenanceToken: %d, owner: %s, reason: %s", maintenanceToken, owner, reason))
+		AuditOwnedOperation("begin-maintenance", instanceKey, owner, fmt.Sprintf("maintenanceToken: %d, owner: %s, reason: %s", maintenanceToken, owner, reason))
 	}
 	return maintenanceToken, err		 
 }
@@ -133,6 +169,66 @@ func EndMaintenanceByInstanceKey(instanceKey *InstanceKey) error {
 }
 
 
+// forceEndMaintenance ends given active maintenance entry, on behalf of an owner who failed to do so
+func forceEndMaintenance(maintenance *Maintenance, cause string) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	res, err := sqlutils.Exec(db, `
+			update
+				database_instance_maintenance
+			set
+				maintenance_active = NULL,
+				end_timestamp = NOW()
+			where
+				database_instance_maintenance_id = ?
+				and maintenance_active = 1
+			`,
+			maintenance.MaintenanceId,
+		 )
+	if err != nil {return log.Errore(err)}
+	if affected, _ := res.RowsAffected(); affected > 0 {
+		AuditOwnedOperation("force-end-maintenance", &maintenance.Key, maintenance.Owner, fmt.Sprintf("maintenanceToken: %d, owner: %s, reason: %s, cause: %s",
+			maintenance.MaintenanceId, maintenance.Owner, maintenance.Reason, cause))
+	}
+	return nil
+}
+
+// ExpireMaintenance forcibly ends active maintenance entries which are past their expiry, or which are
+// owned by an orchestrator process that is gone (e.g. crashed mid-operation). Each such release is audited.
+// Entries with no expiry (begun before expiry was introduced) are ended MaintenanceExpireMinutes after they began.
+func ExpireMaintenance() error {
+	expired, err := readActiveMaintenance("and end_timestamp <= NOW()")
+	if err != nil {return err}
+	for i := range expired {
+		forceEndMaintenance(&expired[i], fmt.Sprintf("expired at %s", expired[i].EndTimestamp))
+	}
+
+	unbounded, err := readActiveMaintenance(`
+			and end_timestamp is null
+			and begin_timestamp < NOW() - interval ? minute`,
+			config.Config.MaintenanceExpireMinutes,
+		)
+	if err != nil {return err}
+	for i := range unbounded {
+		forceEndMaintenance(&unbounded[i], fmt.Sprintf("no expiry, begun at %s", unbounded[i].BeginTimestamp))
+	}
+
+	orphaned, err := readActiveMaintenance(`
+			and processing_node_token != ''
+			and (processing_node_hostname, processing_node_token) not in (
+				select hostname, token from node_health where last_seen_active >= NOW() - interval ? second
+			)`,
+			config.Config.ActiveNodeExpireSeconds,
+		)
+	if err != nil {return err}
+	for i := range orphaned {
+		forceEndMaintenance(&orphaned[i], fmt.Sprintf("owning process %s/%s is gone", orphaned[i].ProcessingNodeHostname, orphaned[i].ProcessingNodeToken))
+	}
+	return nil
+}
+
+
 // ReadMaintenanceInstanceKey will return the instanceKey for active maintenance by maintenanceToken
 func ReadMaintenanceInstanceKey(maintenanceToken int64) (*InstanceKey, error) {
 	var res *InstanceKey
@@ -0,0 +1,88 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"errors"
+	"strings"
+)
+
+// Tag is a free form key/value label attached to an instance (e.g. role=reporting)
+type Tag struct {
+	TagName		string
+	TagValue	string
+}
+
+// ParseTag parses a tag from its name=value representation. The value may be empty.
+func ParseTag(tagString string) (*Tag, error) {
+	tokens := strings.SplitN(tagString, "=", 2)
+	tag := &Tag{TagName: strings.TrimSpace(tokens[0])}
+	if len(tokens) == 2 {
+		tag.TagValue = strings.TrimSpace(tokens[1])
+	}
+	if tag.TagName == "" {
+		return nil, errors.New(fmt.Sprintf("Cannot parse tag from %s. Expected format is name=value", tagString))
+	}
+	return tag, nil
+}
+
+// String returns the name=value representation of this tag
+func (this *Tag) String() string {
+	return fmt.Sprintf("%s=%s", this.TagName, this.TagValue)
+}
+
+// TagSelector is a single condition on instance tags
+type TagSelector struct {
+	TagName		string
+	TagValue	string
+	HasValue	bool	// when false, only the existence of the tag is tested
+	Negate		bool	// selects instances which do not have the tag
+}
+
+// ParseTagSelectors parses a comma delimited list of selectors, all of which must be satisfied.
+// Each selector is of the form "name=value" (tag has given value), "name" (tag exists)
+// or "!name" (tag does not exist).
+func ParseTagSelectors(selectorsString string) ([]TagSelector, error) {
+	selectors := []TagSelector{}
+	for _, token := range strings.Split(selectorsString, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		selector := TagSelector{}
+		if strings.HasPrefix(token, "!") {
+			selector.Negate = true
+			token = token[1:]
+		}
+		tag, err := ParseTag(token)
+		if err != nil {
+			return selectors, err
+		}
+		selector.TagName = tag.TagName
+		selector.TagValue = tag.TagValue
+		selector.HasValue = strings.Contains(token, "=")
+		if selector.Negate && selector.HasValue {
+			return selectors, errors.New(fmt.Sprintf("Negated tag selector cannot have a value: %s", token))
+		}
+		selectors = append(selectors, selector)
+	}
+	if len(selectors) == 0 {
+		return selectors, errors.New(fmt.Sprintf("No tag selectors found in: %s", selectorsString))
+	}
+	return selectors, nil
+}
@@ -0,0 +1,206 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/log"
+)
+
+// PutInstanceTag attaches a tag to an instance, overriding any previous value of same tag name
+func PutInstanceTag(instanceKey *InstanceKey, tag *Tag) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			replace
+				into database_instance_tags (
+					hostname, port, tag_name, tag_value, last_updated
+				) VALUES (
+					?, ?, ?, ?, NOW()
+				)
+			`,
+			instanceKey.Hostname,
+		 	instanceKey.Port,
+		 	tag.TagName,
+		 	tag.TagValue,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	AuditOperation("tag", instanceKey, tag.String())
+	return nil
+}
+
+// UntagInstance removes a tag, by name, from an instance
+func UntagInstance(instanceKey *InstanceKey, tagName string) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			delete
+				from database_instance_tags
+			where
+				hostname = ?
+				and port = ?
+				and tag_name = ?
+			`,
+			instanceKey.Hostname,
+		 	instanceKey.Port,
+		 	tagName,
+		 )
+	if err != nil {return log.Errore(err)}
+
+	AuditOperation("untag", instanceKey, tagName)
+	return nil
+}
+
+// deleteInstanceTags removes all tags of given instance
+func deleteInstanceTags(instanceKey *InstanceKey) error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			delete
+				from database_instance_tags
+			where
+				hostname = ?
+				and port = ?
+			`,
+			instanceKey.Hostname,
+		 	instanceKey.Port,
+		 )
+	return err
+}
+
+// ReadInstanceTags returns the tags of a given instance
+func ReadInstanceTags(instanceKey *InstanceKey) ([]Tag, error) {
+	res := []Tag{}
+	query := `
+		select
+			tag_name,
+			tag_value
+		from
+			database_instance_tags
+		where
+			hostname = ?
+			and port = ?
+		order by
+			tag_name
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	tag := Tag{TagName: m.GetString("tag_name"), TagValue: m.GetString("tag_value")}
+    	res = append(res, tag)
+    	return nil
+   	}, instanceKey.Hostname, instanceKey.Port)
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// readInstanceKeysByTagSelector returns keys of all instances satisfying a single tag selector
+func readInstanceKeysByTagSelector(selector *TagSelector) (InstanceKeyMap, error) {
+	res := make(InstanceKeyMap)
+	query := `
+		select
+			hostname, port
+		from
+			database_instance_tags
+		where
+			tag_name = ?
+			and (tag_value = ? or ? = 0)
+		`
+	args := []interface{}{selector.TagName, selector.TagValue, selector.HasValue}
+	if selector.Negate {
+		query = `
+			select
+				hostname, port
+			from
+				database_instance
+			where
+				(hostname, port) not in (
+					select hostname, port from database_instance_tags where tag_name = ?
+				)
+			`
+		args = []interface{}{selector.TagName}
+	}
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	res[InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")}] = true
+    	return nil
+   	}, args...)
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// ReadInstanceKeysByTags returns keys of all instances satisfying all given tag selectors
+// (see ParseTagSelectors)
+func ReadInstanceKeysByTags(selectorsString string) (InstanceKeyMap, error) {
+	selectors, err := ParseTagSelectors(selectorsString)
+	if err != nil {
+		return make(InstanceKeyMap), err
+	}
+	var res InstanceKeyMap
+	for i := range selectors {
+		instanceKeys, err := readInstanceKeysByTagSelector(&selectors[i])
+		if err != nil {
+			return make(InstanceKeyMap), err
+		}
+		if res == nil {
+			res = instanceKeys
+			continue
+		}
+		// intersect
+		for instanceKey := range res {
+			if !instanceKeys[instanceKey] {
+				delete(res, instanceKey)
+			}
+		}
+	}
+	return res, nil
+}
+
+// FilterInstancesByTags returns those of given instances satisfying all given tag selectors.
+// Empty selectors filter nothing out.
+func FilterInstancesByTags(instances [](*Instance), selectorsString string) ([](*Instance), error) {
+	if selectorsString == "" {
+		return instances, nil
+	}
+	res := [](*Instance){}
+	instanceKeys, err := ReadInstanceKeysByTags(selectorsString)
+	if err != nil {
+		return res, err
+	}
+	for _, instance := range instances {
+		if instanceKeys[instance.Key] {
+			res = append(res, instance)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,124 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package orchestrator
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"time"
+	"github.com/outbrain/orchestrator/inst"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// seedsFileModTime is the modification time of the seeds file as of last read
+var seedsFileModTime time.Time
+
+// readSeedsFile reads host:port entries from given file, one per line. Empty lines and lines
+// beginning with '#' are ignored, as are (with a logged error) unparsable lines.
+func readSeedsFile(fileName string) (inst.InstanceKeyMap, error) {
+	instanceKeys := make(inst.InstanceKeyMap)
+	file, err := os.Open(fileName)
+	if err != nil {return instanceKeys, log.Errore(err)}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		instanceKey, err := inst.ParseInstanceKey(line)
+		if err != nil {
+			log.Errorf("Cannot parse seed entry in %s: %s", fileName, line)
+			continue
+		}
+		instanceKeys[*instanceKey] = true
+	}
+	return instanceKeys, scanner.Err()
+}
+
+// discoverSeed registers a single seed instance and submits it to continuous discovery
+func discoverSeed(instanceKey inst.InstanceKey, seedSource string) {
+	inst.RegisterDiscoverySeed(&instanceKey, seedSource)
+	discoveryInstanceKeys <- instanceKey
+}
+
+// DiscoverConfigSeeds starts discovery on all instances listed by the DiscoverySeeds config variable.
+// Stored config seeds no longer listed are flagged as removed.
+func DiscoverConfigSeeds() {
+	instanceKeys := make(inst.InstanceKeyMap)
+	for _, seed := range config.Config.DiscoverySeeds {
+		instanceKey, err := inst.ParseInstanceKey(seed)
+		if err != nil {
+			log.Errorf("Cannot parse DiscoverySeeds entry: %s", seed)
+			continue
+		}
+		instanceKeys[*instanceKey] = true
+		discoverSeed(*instanceKey, inst.DiscoverySeedSourceConfig)
+	}
+	storedKeys, err := inst.ReadDiscoverySeedKeys(inst.DiscoverySeedSourceConfig)
+	if err != nil {
+		return
+	}
+	for instanceKey := range storedKeys {
+		if !instanceKeys[instanceKey] {
+			inst.RemoveDiscoverySeed(&instanceKey, inst.DiscoverySeedSourceConfig)
+		}
+	}
+}
+
+// DiscoverSeedsFileChanges re-reads the seeds file, if changed since last read. Entries are compared
+// with the file seeds stored in the backend: new entries are sent for discovery, and entries no longer
+// listed are flagged as removed (including those removed while orchestrator was down).
+func DiscoverSeedsFileChanges() {
+	fileName := config.Config.DiscoverySeedsFile
+	if fileName == "" {
+		return
+	}
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	if fileInfo.ModTime().Equal(seedsFileModTime) {
+		// Unchanged
+		return
+	}
+	instanceKeys, err := readSeedsFile(fileName)
+	if err != nil {
+		return
+	}
+	storedKeys, err := inst.ReadDiscoverySeedKeys(inst.DiscoverySeedSourceFile)
+	if err != nil {
+		return
+	}
+	seedsFileModTime = fileInfo.ModTime()
+	log.Infof("Read %d seeds from %s", len(instanceKeys), fileName)
+
+	for instanceKey := range instanceKeys {
+		if !storedKeys[instanceKey] {
+			discoverSeed(instanceKey, inst.DiscoverySeedSourceFile)
+		}
+	}
+	for instanceKey := range storedKeys {
+		if !instanceKeys[instanceKey] {
+			inst.RemoveDiscoverySeed(&instanceKey, inst.DiscoverySeedSourceFile)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"time"
 	"github.com/outbrain/orchestrator/inst"
 	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/process"
 	"github.com/outbrain/log"
 )
 
@@ -28,16 +29,17 @@ const (
 	maxConcurrency = 5
 )
 
-// discoveryInstanceKeys is a channel of instanceKey-s that were requested for discovery.
+// discoveryInstanceKeys is a channel of instanceKey-s that were requested for continuous discovery.
 // It can be continuously updated as discovery process progresses.
 var discoveryInstanceKeys chan inst.InstanceKey = make(chan inst.InstanceKey, maxConcurrency)
 
 
-// handleDiscoveryRequests iterates the discoveryInstanceKeys channel and calls upon
-// instance discovery per entry.
-func handleDiscoveryRequests(pendingTokens chan bool, completedTokens chan bool) {
-    for instanceKey := range discoveryInstanceKeys {
-        AccountedDiscoverInstance(instanceKey, pendingTokens, completedTokens)
+// handleDiscoveryRequests iterates given channel of instanceKey-s and calls upon
+// instance discovery per entry. Continuous discovery is split between orchestrator nodes: it only
+// polls known instances owned by this node. One-off discovery polls all.
+func handleDiscoveryRequests(instanceKeys chan inst.InstanceKey, continuous bool, pendingTokens chan bool, completedTokens chan bool) {
+    for instanceKey := range instanceKeys {
+        AccountedDiscoverInstance(instanceKey, instanceKeys, continuous, pendingTokens, completedTokens)
     }
 }
 
@@ -45,12 +47,12 @@ func handleDiscoveryRequests(pendingTokens chan bool, completedTokens chan bool)
 // AccountedDiscoverInstance will call upon DiscoverInstance and will keep track of 
 // discovery tokens such that management of multiple discoveries can figure out
 // whether all instances in a topology are accounted for.
-func AccountedDiscoverInstance(instanceKey inst.InstanceKey, pendingTokens chan bool, completedTokens chan bool) {
+func AccountedDiscoverInstance(instanceKey inst.InstanceKey, instanceKeys chan inst.InstanceKey, continuous bool, pendingTokens chan bool, completedTokens chan bool) {
 	if pendingTokens != nil {
 		pendingTokens <- true
 	}
 	go func () {
-		DiscoverInstance(instanceKey)
+		DiscoverInstance(instanceKey, instanceKeys, continuous)
 		if completedTokens != nil {
 			completedTokens <- true
 		}
@@ -59,12 +61,17 @@ func AccountedDiscoverInstance(instanceKey inst.InstanceKey, pendingTokens chan
 
 
 // DiscoverInstance will attempt discovering an instance (unless it is already up to date) and will
-// list down its master and slaves (if any) for further discovery.
-func DiscoverInstance(instanceKey inst.InstanceKey) {
+// list down its master and slaves (if any) for further discovery onto given channel.
+// In continuous discovery, a known instance is only polled by the node owning it (see process.IsDiscoveryOwner);
+// an instance yet unknown is polled by whichever node finds it, after which it is known to its owner.
+func DiscoverInstance(instanceKey inst.InstanceKey, instanceKeys chan inst.InstanceKey, continuous bool) {
 	instanceKey.Formalize()
 	if !instanceKey.IsValid() {
 		return
 	}
+	if inst.IsDiscoveryIgnoredInstance(&instanceKey) {
+		return
+	}
 	
 	instance, found, err := inst.ReadInstance(&instanceKey)
 	
@@ -72,6 +79,10 @@ func DiscoverInstance(instanceKey inst.InstanceKey) {
 		// we've already discovered this one. Skip!
 		goto Cleanup
 	}
+	if found && continuous && !process.IsDiscoveryOwner(instanceKey.DisplayString()) {
+		// Another node polls this one
+		goto Cleanup
+	}
 	// First we've ever heard of this instance. Continue investigation:
 	instance, err = inst.ReadTopologyInstance(&instanceKey)
 	// panic can occur (IO stuff). Therefore it may happen
@@ -82,10 +93,10 @@ func DiscoverInstance(instanceKey inst.InstanceKey) {
 
 	// Investigate slaves:
 	for _, slaveKey := range instance.SlaveHosts.GetInstanceKeys() {
-		discoveryInstanceKeys <- slaveKey
+		instanceKeys <- slaveKey
 	}
 	// Investigate master:
-	discoveryInstanceKeys <- instance.MasterKey
+	instanceKeys <- *inst.ResolveInstanceKeyAlias(&instance.MasterKey)
 	
 	
 	Cleanup:
@@ -100,11 +111,12 @@ func DiscoverInstance(instanceKey inst.InstanceKey) {
 // in such topology, this function will detect the entire topology.
 func StartDiscovery(instanceKey inst.InstanceKey) {
 	log.Infof("Starting discovery at %+v", instanceKey)
+	instanceKeys := make(chan inst.InstanceKey, maxConcurrency)
 	pendingTokens := make(chan bool, maxConcurrency)
 	completedTokens := make(chan bool, maxConcurrency)
 
-	AccountedDiscoverInstance(instanceKey, pendingTokens, completedTokens) 
-	go handleDiscoveryRequests(pendingTokens, completedTokens)
+	AccountedDiscoverInstance(instanceKey, instanceKeys, false, pendingTokens, completedTokens) 
+	go handleDiscoveryRequests(instanceKeys, false, pendingTokens, completedTokens)
 	
 	// Block until all are complete
 	for {
@@ -121,21 +133,61 @@ func StartDiscovery(instanceKey inst.InstanceKey) {
 // ContinuousDiscovery starts an asynchronuous infinite discovery process where instances are
 // periodically investigated and their status captured, and long since unseen instances are
 // purged and forgotten.
+// Multiple orchestrator processes may run continuous discovery: polling of instances is split between them
+// by consistent hashing, and only the elected leader runs the other periodic jobs.
 func ContinuousDiscovery() {
 	log.Infof("Starting continuous discovery")
-	go handleDiscoveryRequests(nil, nil)
+	process.EnableDiscoveryNode()
+	process.StartContinuousElection()
+	process.RefreshDiscoveryRing()
+	go handleDiscoveryRequests(discoveryInstanceKeys, true, nil, nil)
+	DiscoverConfigSeeds()
+	// The seeds file is read by the leader, upon its first tick
     tick := time.Tick(time.Duration(config.Config.DiscoveryPollSeconds) * time.Second)
     forgetUnseenTick := time.Tick(time.Hour)
+    // A nil channel (snapshots disabled) is never selected
+    snapshotTopologiesTick := time.Tick(time.Duration(config.Config.TopologySnapshotIntervalMinutes) * time.Minute)
+    recomputeClusterNamesTick := time.Tick(time.Duration(config.Config.InstancePollSeconds) * time.Second)
+    expireEntriesTick := time.Tick(time.Minute)
     for _ = range tick {
+		process.RefreshDiscoveryRing()
 		instanceKeys, _ := inst.ReadOutdatedInstanceKeys()
 		log.Debugf("outdated keys: %+v", instanceKeys)
 		for _, instanceKey := range instanceKeys {
-			discoveryInstanceKeys <- instanceKey
+			if process.IsDiscoveryOwner(instanceKey.DisplayString()) {
+				discoveryInstanceKeys <- instanceKey
+			}
 		}
+		if !process.IsElected() {
+			continue
+		}
+		DiscoverSeedsFileChanges()
     	// See if we should also forget instances (lower frequency)
 		select {
 			case <- forgetUnseenTick:
 		    	inst.ForgetLongUnseenInstances()
+		    	inst.ExpireCandidateInstances()
+		    	inst.ExpireTopologyHistory()
+		    	inst.DownsampleLagHistory()
+		    	inst.ExpireLagHistory()
+		    	go inst.PurgeAudit()
+		    	process.ExpireNodeHealth()
+			default:
+		}
+		select {
+			case <- snapshotTopologiesTick:
+				go inst.SnapshotTopologies()
+			default:
+		}
+		select {
+			case <- recomputeClusterNamesTick:
+				go inst.RecomputeClusterNames()
+			default:
+		}
+		select {
+			case <- expireEntriesTick:
+				go inst.ExpireDowntime()
+				go inst.ExpireMaintenance()
 			default:
 		}
 	}
@@ -26,11 +26,20 @@ import (
 // main is the application's entry point. It will either spawn a CLI or HTTP itnerfaces.
 func main() {
 	configFile := flag.String("config", "", "config file name")
-	command := flag.String("c", "", "command (discover|forget|continuous|move-up|move-below|begin-maintenance|end-maintenance|clusters|topology)")
+	command := flag.String("c", "", "command (discover|forget|continuous|move-up|move-up-slaves|move-below|begin-maintenance|end-maintenance|clusters|cluster|search|topology|tag|untag|tags|tagged|register-candidate|candidate-slave|events|discovery-timings|begin-downtime|end-downtime|downtimed|migrate-status|audit-export|audit)")
 	instance := flag.String("i", "", "instance, host:port")
 	sibling := flag.String("s", "", "sibling instance, host:port")
 	owner := flag.String("owner", "", "operation owner")
 	reason := flag.String("reason", "", "operation reason")
+	tag := flag.String("tag", "", "tag (name=value), or comma delimited tag selectors (name=value, name, !name) for tagged, cluster, search, move-up-slaves")
+	promotionRule := flag.String("promotion-rule", "prefer", "promotion rule for register-candidate (prefer|neutral|prefer_not|must_not)")
+	page := flag.Int("page", 0, "page number, for paged listings (e.g. events)")
+	duration := flag.String("duration", "", "duration for begin-downtime, begin-maintenance (e.g. 30m, 4h)")
+	since := flag.String("since", "", "start of time range, inclusive (YYYY-MM-DD HH:MM:SS), for audit, audit-export")
+	until := flag.String("until", "", "end of time range, exclusive (YYYY-MM-DD HH:MM:SS), for audit, audit-export")
+	auditType := flag.String("audit-type", "", "audit entry type (e.g. begin-maintenance), for audit")
+	cluster := flag.String("cluster", "", "cluster name, for audit")
+	file := flag.String("file", "", "output file name, for audit-export")
 	discovery := flag.Bool("discovery", true, "auto discovery mode")
 	verbose := flag.Bool("verbose", false, "verbose")
 	debug := flag.Bool("debug", false, "debug mode (very verbose)")
@@ -54,7 +63,21 @@ func main() {
 
 	switch {
 		case len(flag.Args()) == 0 || flag.Arg(0) == "cli": 
-			app.Cli(*command, *instance, *sibling, *owner, *reason)
+			app.Cli(*command, &app.CliFlags{
+				Instance:		*instance,
+				Sibling:		*sibling,
+				Owner:			*owner,
+				Reason:			*reason,
+				Tag:			*tag,
+				PromotionRule:	*promotionRule,
+				Page:			*page,
+				Duration:		*duration,
+				Since:			*since,
+				Until:			*until,
+				File:			*file,
+				AuditType:		*auditType,
+				Cluster:		*cluster,
+			})
 		case flag.Arg(0) == "http": 
 			app.Http(*discovery)
 		default:
@@ -0,0 +1,106 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// isDiscoveryNode indicates this process takes part in continuous discovery, and so is assigned instances to poll
+var isDiscoveryNode bool = false
+
+var discoveryRing *HashRing = NewHashRing([]string{})
+var discoveryRingMutex sync.Mutex
+
+// ThisNodeId identifies this process on the discovery ring
+func ThisNodeId() string {
+	return fmt.Sprintf("%s/%s", ThisHostname, ProcessToken)
+}
+
+// EnableDiscoveryNode marks this process as taking part in continuous discovery. This is reflected
+// in its health registration.
+func EnableDiscoveryNode() {
+	isDiscoveryNode = true
+}
+
+// ReadDiscoveryNodes returns the ids of live processes taking part in continuous discovery
+func ReadDiscoveryNodes() ([]string, error) {
+	res := []string{}
+	query := `
+		select
+			hostname,
+			token
+		from
+			node_health
+		where
+			is_discovery_node = 1
+			and last_seen_active >= NOW() - interval ? second
+		order by
+			hostname, token
+		`
+	db,	err	:=	db.OpenOrchestrator()
+    if err != nil {goto Cleanup}
+
+    err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+    	res = append(res, fmt.Sprintf("%s/%s", m.GetString("hostname"), m.GetString("token")))
+    	return nil
+   	}, config.Config.ActiveNodeExpireSeconds)
+	Cleanup:
+
+	if err	!=	nil	{
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// RefreshDiscoveryRing rebuilds the discovery ring from the live discovery nodes. Instances are thus
+// rebalanced as nodes join or leave.
+func RefreshDiscoveryRing() error {
+	nodes, err := ReadDiscoveryNodes()
+	if err != nil {return err}
+
+	discoveryRingMutex.Lock()
+	defer discoveryRingMutex.Unlock()
+	if strings.Join(nodes, ",") != strings.Join(discoveryRing.Nodes(), ",") {
+		log.Infof("Discovery nodes changed; rebalancing over: %+v", nodes)
+		discoveryRing = NewHashRing(nodes)
+	}
+	return nil
+}
+
+// GetDiscoveryOwner returns the id of the node in charge of polling given instance (as "host:port").
+// With no known discovery nodes, this node is in charge.
+func GetDiscoveryOwner(instanceKey string) string {
+	discoveryRingMutex.Lock()
+	defer discoveryRingMutex.Unlock()
+
+	if owner := discoveryRing.GetNode(instanceKey); owner != "" {
+		return owner
+	}
+	return ThisNodeId()
+}
+
+// IsDiscoveryOwner returns true when this node is in charge of polling given instance
+func IsDiscoveryOwner(instanceKey string) bool {
+	return GetDiscoveryOwner(instanceKey) == ThisNodeId()
+}
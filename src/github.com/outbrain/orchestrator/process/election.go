@@ -0,0 +1,175 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// LeaderLease describes the orchestrator process currently elected to run periodic jobs & recoveries
+type LeaderLease struct {
+	Hostname				string
+	Token					string
+	FirstSeenActive			string
+	LastSeenActive			string
+	SecondsSinceHeartbeat	uint
+}
+
+// NodeStatus describes this orchestrator process and its view of the leadership
+type NodeStatus struct {
+	Hostname	string
+	Token		string
+	IsElected	bool
+	Leader		*LeaderLease
+}
+
+var isElected bool = false
+var isElectedMutex sync.Mutex
+var continuousElectionOnce sync.Once
+
+// IsElected returns true when this process holds the leader lease, as of its last election attempt
+func IsElected() bool {
+	isElectedMutex.Lock()
+	defer isElectedMutex.Unlock()
+	return isElected
+}
+
+func setElected(elected bool) {
+	isElectedMutex.Lock()
+	defer isElectedMutex.Unlock()
+	if elected != isElected {
+		if elected {
+			log.Infof("Elected as leader: %s/%s", ThisHostname, ProcessToken)
+		} else {
+			log.Infof("No longer leader: %s/%s", ThisHostname, ProcessToken)
+		}
+	}
+	isElected = elected
+}
+
+// AttemptElection takes the leader lease if it is free or expired (not renewed for ActiveNodeExpireSeconds),
+// or renews it if already held by this process. Returns true when this process holds the lease.
+func AttemptElection() (bool, error) {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return false, log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			insert ignore
+				into active_node (
+					anchor, hostname, token, first_seen_active, last_seen_active
+				) VALUES (
+					1, ?, ?, NOW(), NOW()
+				)
+			`,
+			ThisHostname,
+			ProcessToken,
+		 )
+	if err != nil {return false, log.Errore(err)}
+
+	// Note: assignments are evaluated in order; first_seen_active relies on the previous leader identity
+	_, err = sqlutils.Exec(db, `
+			update
+				active_node
+			set
+				first_seen_active = if(hostname = ? and token = ?, first_seen_active, NOW()),
+				hostname = ?,
+				token = ?,
+				last_seen_active = NOW()
+			where
+				anchor = 1
+				and (
+					(hostname = ? and token = ?)
+					or last_seen_active < NOW() - interval ? second
+				)
+			`,
+			ThisHostname, ProcessToken,
+			ThisHostname, ProcessToken,
+			ThisHostname, ProcessToken,
+			config.Config.ActiveNodeExpireSeconds,
+		 )
+	if err != nil {return false, log.Errore(err)}
+
+	leader, err := ReadLeader()
+	if err != nil {return false, err}
+	elected := (leader != nil && leader.Hostname == ThisHostname && leader.Token == ProcessToken)
+	setElected(elected)
+	return elected, nil
+}
+
+// ReadLeader returns the current leader lease, or nil if none was ever taken
+func ReadLeader() (*LeaderLease, error) {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return nil, log.Errore(err)}
+
+	leader := &LeaderLease{}
+	err = db.QueryRow(`
+		select
+			hostname,
+			token,
+			first_seen_active,
+			last_seen_active,
+			timestampdiff(second, last_seen_active, NOW()) as seconds_since_heartbeat
+		from
+			active_node
+		where
+			anchor = 1`).Scan(
+			&leader.Hostname,
+			&leader.Token,
+			&leader.FirstSeenActive,
+			&leader.LastSeenActive,
+			&leader.SecondsSinceHeartbeat,
+		)
+	if err == sql.ErrNoRows {return nil, nil}
+	if err != nil {return nil, log.Errore(err)}
+	return leader, nil
+}
+
+// ReadNodeStatus returns this process' identity and leadership status
+func ReadNodeStatus() (*NodeStatus, error) {
+	leader, err := ReadLeader()
+	if err != nil {return nil, err}
+	return &NodeStatus{
+		Hostname:	ThisHostname,
+		Token:		ProcessToken,
+		IsElected:	IsElected(),
+		Leader:		leader,
+	}, nil
+}
+
+// StartContinuousElection attempts election (and so renews the lease when elected) every HealthPollSeconds,
+// for as long as the process lives. The process also registers itself as alive.
+// Multiple calls start a single election routine.
+func StartContinuousElection() {
+	StartContinuousRegistration()
+	continuousElectionOnce.Do(func() {
+		AttemptElection()
+		go func() {
+			for _ = range time.Tick(time.Duration(config.Config.HealthPollSeconds) * time.Second) {
+				if _, err := AttemptElection(); err != nil {
+					// Cannot tell whether we still hold the lease; better step down
+					setElected(false)
+				}
+			}
+		}()
+	})
+}
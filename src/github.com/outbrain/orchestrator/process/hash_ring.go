@@ -0,0 +1,78 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// hashRingReplicas is the number of points each node takes on the ring; more points make for a more even split
+const hashRingReplicas = 64
+
+// HashRing assigns keys to nodes by consistent hashing: adding or removing a node only reassigns
+// the keys owned by that node.
+type HashRing struct {
+	points	[]uint32
+	owners	map[uint32]string
+	nodes	[]string
+}
+
+type uint32Slice []uint32
+
+func (this uint32Slice) Len() int			{ return len(this) }
+func (this uint32Slice) Swap(i, j int)		{ this[i], this[j] = this[j], this[i] }
+func (this uint32Slice) Less(i, j int) bool	{ return this[i] < this[j] }
+
+// NewHashRing creates a ring over given nodes
+func NewHashRing(nodes []string) *HashRing {
+	ring := &HashRing{owners: make(map[uint32]string)}
+	ring.nodes = append(ring.nodes, nodes...)
+	sort.Strings(ring.nodes)
+	for _, node := range ring.nodes {
+		for i := 0; i < hashRingReplicas; i++ {
+			point := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", node, i)))
+			if _, taken := ring.owners[point]; taken {
+				// Collisions are resolved in favor of the first (sorted) node, keeping the ring deterministic
+				continue
+			}
+			ring.owners[point] = node
+			ring.points = append(ring.points, point)
+		}
+	}
+	sort.Sort(uint32Slice(ring.points))
+	return ring
+}
+
+// Nodes returns the (sorted) nodes on this ring
+func (this *HashRing) Nodes() []string {
+	return this.nodes
+}
+
+// GetNode returns the node owning given key, or an empty string for an empty ring
+func (this *HashRing) GetNode(key string) string {
+	if len(this.points) == 0 {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	index := sort.Search(len(this.points), func(i int) bool { return this.points[i] >= hash })
+	if index == len(this.points) {
+		index = 0
+	}
+	return this.owners[this.points[index]]
+}
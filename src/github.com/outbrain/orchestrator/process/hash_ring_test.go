@@ -0,0 +1,54 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+	"testing"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+
+func (s *TestSuite) TestHashRing(c *C) {
+	instanceKeys := []string{}
+	for i := 0; i < 1000; i++ {
+		instanceKeys = append(instanceKeys, fmt.Sprintf("db%04d.db:3306", i))
+	}
+	ring := NewHashRing([]string{"node1", "node2", "node3"})
+	c.Assert(NewHashRing([]string{"node3", "node1", "node2"}).GetNode(instanceKeys[0]), Equals, ring.GetNode(instanceKeys[0]))
+
+	owned := make(map[string]int)
+	for _, instanceKey := range instanceKeys {
+		owned[ring.GetNode(instanceKey)]++
+	}
+	c.Assert(len(owned), Equals, 3)
+
+	// Removing a node only reassigns that node's keys
+	shrunkRing := NewHashRing([]string{"node1", "node3"})
+	for _, instanceKey := range instanceKeys {
+		if owner := ring.GetNode(instanceKey); owner != "node2" {
+			c.Assert(shrunkRing.GetNode(instanceKey), Equals, owner)
+		}
+	}
+	c.Assert(NewHashRing([]string{}).GetNode(instanceKeys[0]), Equals, "")
+}
@@ -0,0 +1,96 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"github.com/outbrain/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/log"
+)
+
+// ThisHostname is the name of the host running this orchestrator process
+var ThisHostname string
+
+// ProcessToken uniquely identifies this orchestrator process (hostname alone does not, as multiple
+// processes may run on the same host, or a process may restart)
+var ProcessToken string
+
+func init() {
+	ThisHostname, _ = os.Hostname()
+	ProcessToken = fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%s:%d:%d", ThisHostname, os.Getpid(), time.Now().UnixNano()))))
+}
+
+var continuousRegistrationOnce sync.Once
+
+// RegisterNodeHealth marks this process as alive in the node_health table
+func RegisterNodeHealth() error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			insert
+				into node_health (
+					hostname, token, is_discovery_node, first_seen_active, last_seen_active
+				) VALUES (
+					?, ?, ?, NOW(), NOW()
+				)
+				on duplicate key update
+					is_discovery_node = values(is_discovery_node),
+					last_seen_active = NOW()
+			`,
+			ThisHostname,
+			ProcessToken,
+			isDiscoveryNode,
+		 )
+	if err != nil {return log.Errore(err)}
+	return nil
+}
+
+// StartContinuousRegistration periodically (every HealthPollSeconds) registers this process as alive,
+// for as long as the process lives. Multiple calls start a single registration routine.
+func StartContinuousRegistration() {
+	continuousRegistrationOnce.Do(func() {
+		RegisterNodeHealth()
+		go func() {
+			for _ = range time.Tick(time.Duration(config.Config.HealthPollSeconds) * time.Second) {
+				RegisterNodeHealth()
+			}
+		}()
+	})
+}
+
+// ExpireNodeHealth removes entries of processes which have long since stopped registering
+func ExpireNodeHealth() error {
+	db,	err	:=	db.OpenOrchestrator()
+	if err != nil {return log.Errore(err)}
+
+	_, err = sqlutils.Exec(db, `
+			delete
+				from node_health
+			where
+				last_seen_active < NOW() - interval ? hour
+			`,
+			config.Config.UnseenInstanceForgetHours,
+		 )
+	return err
+}
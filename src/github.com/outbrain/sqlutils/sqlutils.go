@@ -69,19 +69,25 @@ func (this *RowMap) GetBool(key string) bool {
 // knownDBs is a DB cache by uri
 var knownDBs map[string]*sql.DB = make(map[string]*sql.DB)
 
-// GetDB returns a DB instance based on uri. 
+// GetDB returns a MySQL DB instance based on uri. 
 // bool result indicates whether the DB was returned from cache; err
 func GetDB(mysql_uri string) (*sql.DB, bool, error) {
-	
+	return GetGenericDB("mysql", mysql_uri)
+}
+
+// GetGenericDB returns a DB instance of given driver, based on data source name. 
+// bool result indicates whether the DB was returned from cache; err
+func GetGenericDB(driverName string, dataSourceName string) (*sql.DB, bool, error) {
+	cacheKey := driverName + ":" + dataSourceName
 	var exists bool
-	if _, exists = knownDBs[mysql_uri]; !exists {
-	    if db, err := sql.Open("mysql", mysql_uri); err == nil {
-	    	knownDBs[mysql_uri] = db
+	if _, exists = knownDBs[cacheKey]; !exists {
+	    if db, err := sql.Open(driverName, dataSourceName); err == nil {
+	    	knownDBs[cacheKey] = db
 	    } else {
 	    	return db, exists, err
 	    }	    	    
 	}
-	return knownDBs[mysql_uri], exists, nil
+	return knownDBs[cacheKey], exists, nil
 }
 
 // RowToArray is a convenience function, typically not called directly, which maps a
@@ -131,9 +137,9 @@ func ScanRowsToMaps(rows *sql.Rows, on_row func(RowMap) error) error {
 
 
 // QueryRowsMap is a convenience function allowing querying a result set while poviding a callback
-// function activated per read row.
-func QueryRowsMap(db *sql.DB, query string, on_row func(RowMap) error) error {
-	rows, err := db.Query(query)
+// function activated per read row. Optional args are bound to the query's placeholders.
+func QueryRowsMap(db *sql.DB, query string, on_row func(RowMap) error, args ...interface{}) error {
+	rows, err := db.Query(query, args...)
 	defer rows.Close()
 	if err != nil && err != sql.ErrNoRows {
 		return log.Errore(err)